@@ -1,5 +1,12 @@
 module 1laba
 
-go 1.21
+go 1.23.2
 
-require github.com/lib/pq v1.10.9 // indirect
+require (
+	github.com/lib/pq v1.10.9
+	platform v0.0.0
+)
+
+require gopkg.in/yaml.v3 v3.0.1 // indirect
+
+replace platform => ../kursach/platform
@@ -6,26 +6,24 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"platform/config"
 
 	_ "github.com/lib/pq"
 )
 
+type Config struct {
+	Port int             `yaml:"port" env:"APP_PORT" flag:"port" default:"8080"`
+	DB   config.Postgres `yaml:"db"`
+}
+
 func main() {
-	port := os.Getenv("APP_PORT")
-	if port == "" {
-		port = "8080"
+	var cfg Config
+	if err := config.Load(&cfg, os.Args[1:]); err != nil {
+		log.Fatalf("config: %v", err)
 	}
+	log.Print("effective config:\n", config.Redacted(&cfg))
 
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_NAME")
-
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("postgres", cfg.DB.DSN())
 	if err != nil {
 		log.Fatalf("Error connecting to database: %v", err)
 	}
@@ -41,6 +39,6 @@ func main() {
 		fmt.Fprintln(w, "Бдшка работает")
 	})
 
-	log.Printf("running on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Printf("running on port %d", cfg.Port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), nil))
 }
@@ -0,0 +1,117 @@
+// Package contracts is what the handler and the worker exchange through
+// RabbitMQ: the book, the command and event messages and the names of the
+// exchanges, routing keys and queues. Both services build against it, so a
+// change to a message is a compile error on the other side rather than a
+// silently dropped field.
+package contracts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Book is the body of the create, update, delete and restore commands and
+// the state carried by events. Delete and restore only read Id.
+type Book struct {
+	Id          int      `json:"id"`
+	Title       string   `json:"title"`
+	Authors     []string `json:"authors"`
+	ISBN        string   `json:"isbn,omitempty"`
+	Year        int      `json:"year,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Tags        []string `json:"tags"`
+	Description string   `json:"description"`
+	Version     int      `json:"version,omitempty"`
+	// DeletedAt is only set on books listed from the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Normalize trims the text fields, strips separators from the ISBN and
+// drops empty authors and tags so equal books compare equal.
+func (b *Book) Normalize() {
+	b.Title = strings.TrimSpace(b.Title)
+	b.ISBN = strings.NewReplacer("-", "", " ", "").Replace(b.ISBN)
+	b.Language = strings.ToLower(strings.TrimSpace(b.Language))
+	b.Authors = compact(b.Authors)
+	b.Tags = compact(b.Tags)
+	for i, tag := range b.Tags {
+		b.Tags[i] = strings.ToLower(tag)
+	}
+}
+
+// Validate reports every field that cannot be stored as a
+// ValidationError. It expects a normalized book.
+func (b Book) Validate() error {
+	var errs ValidationError
+	if b.ISBN != "" && !ValidISBN13(b.ISBN) {
+		errs = append(errs, FieldError{"isbn", fmt.Sprintf("%q is not a valid ISBN-13", b.ISBN)})
+	}
+	if b.Year < 0 || b.Year > time.Now().Year()+1 {
+		errs = append(errs, FieldError{"year", fmt.Sprintf("%d is out of range", b.Year)})
+	}
+	if b.Language != "" && !validLanguage(b.Language) {
+		errs = append(errs, FieldError{"language", fmt.Sprintf("%q is not an ISO 639 code", b.Language)})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidISBN13 checks the length and the check digit of a bare ISBN-13.
+func ValidISBN13(isbn string) bool {
+	if len(isbn) != 13 {
+		return false
+	}
+	sum := 0
+	for i, r := range isbn {
+		if r < '0' || r > '9' {
+			return false
+		}
+		d := int(r - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func validLanguage(code string) bool {
+	if len(code) < 2 || len(code) > 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func compact(values []string) []string {
+	out := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a book.
+type ValidationError []FieldError
+
+func (v ValidationError) Error() string {
+	parts := make([]string, len(v))
+	for i, f := range v {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,52 @@
+package contracts
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateISBN(t *testing.T) {
+	tests := []struct {
+		name  string
+		isbn  string
+		valid bool
+	}{
+		{"bare", "9785170987658", true},
+		{"hyphens", "978-5-17-098765-8", true},
+		{"spaces", "978 5 17 098765 8", true},
+		{"mixed separators", " 978-5 17-098765-8 ", true},
+		{"zero check digit", "9780306406157", true},
+		{"wrong check digit", "9785170987652", false},
+		{"swapped digits", "9785170987568", false},
+		{"ISBN-10", "0306406152", false},
+		{"ISBN-10 with X", "080442957X", false},
+		{"too long", "97851709876520", false},
+		{"letters", "978517098765a", false},
+		{"empty is allowed", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Book{Title: "t", ISBN: tt.isbn}
+			b.Normalize()
+			err := b.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Validate(%q) = %v, want no error", tt.isbn, err)
+			}
+			if !tt.valid {
+				var verr ValidationError
+				if !errors.As(err, &verr) || len(verr) != 1 || verr[0].Field != "isbn" {
+					t.Errorf("Validate(%q) = %v, want an isbn error", tt.isbn, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidISBN13NeedsNormalizedInput(t *testing.T) {
+	if ValidISBN13("978-5-17-098765-8") {
+		t.Error("ValidISBN13 accepted separators; callers must Normalize first")
+	}
+	if !ValidISBN13("9785170987658") {
+		t.Error("ValidISBN13 rejected a valid ISBN-13")
+	}
+}
@@ -0,0 +1,45 @@
+package contracts
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The worker and the handler share the Redis book cache: the handler
+// fills it on reads, the worker marks books it changed.
+
+// CacheTombstone is what the worker leaves for a deleted book. The handler
+// never overwrites it, so a read racing with the delete cannot put the
+// book back.
+const CacheTombstone = "deleted"
+
+// CacheStalePrefix starts the marker the worker leaves for a changed book,
+// "stale:<version>". Only a read of that version or a later one may
+// replace it.
+const CacheStalePrefix = "stale:"
+
+// cacheNamespace versions the cache format. Bump it when the cached value
+// changes shape: entries of an older format are then never read and expire
+// on their own.
+const cacheNamespace = "book:v2:"
+
+// CacheKey is the Redis key of book id.
+func CacheKey(id int) string {
+	return cacheNamespace + strconv.Itoa(id)
+}
+
+// StaleMarker is the cache value saying book versions below version are
+// out of date.
+func StaleMarker(version int) string {
+	return CacheStalePrefix + strconv.Itoa(version)
+}
+
+// ParseStaleMarker returns the version of a StaleMarker value.
+func ParseStaleMarker(val string) (int, bool) {
+	s, ok := strings.CutPrefix(val, CacheStalePrefix)
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.Atoi(s)
+	return version, err == nil && version >= 0
+}
@@ -0,0 +1,30 @@
+package contracts
+
+import "testing"
+
+func TestStaleMarkerRoundTrip(t *testing.T) {
+	for _, version := range []int{0, 1, 42, 1 << 30} {
+		got, ok := ParseStaleMarker(StaleMarker(version))
+		if !ok || got != version {
+			t.Errorf("ParseStaleMarker(StaleMarker(%d)) = %d, %v", version, got, ok)
+		}
+	}
+}
+
+func TestParseStaleMarkerRejects(t *testing.T) {
+	for _, val := range []string{"", CacheTombstone, "stale:", "stale:-1", "stale:x", `{"book":{}}`, "3"} {
+		if _, ok := ParseStaleMarker(val); ok {
+			t.Errorf("ParseStaleMarker(%q) accepted a value that is not a marker", val)
+		}
+	}
+}
+
+func TestCacheKeysAreDistinct(t *testing.T) {
+	if CacheKey(1) == CacheKey(11) || CacheKey(7) != CacheKey(7) {
+		t.Errorf("CacheKey is not one key per book: %q, %q", CacheKey(1), CacheKey(11))
+	}
+	// Entries of the first format were stored under the bare id.
+	if CacheKey(7) == "7" {
+		t.Errorf("CacheKey(7) = %q shares a key with the legacy cache format", CacheKey(7))
+	}
+}
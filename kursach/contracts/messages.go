@@ -0,0 +1,77 @@
+package contracts
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Exchange is the direct exchange the handler publishes commands to.
+const Exchange = "do.direct"
+
+// EventsExchange is the fanout exchange the worker publishes book events
+// to. Every handler instance binds its own queue, so each one sees every
+// event.
+const EventsExchange = "book.events"
+
+// Command names one kind of command and where it travels. Kind is also
+// what the operations table records.
+type Command struct {
+	Kind       string
+	RoutingKey string
+	Queue      string
+}
+
+var (
+	CommandCreate  = Command{Kind: "create", RoutingKey: "create.key", Queue: "queue.create"}
+	CommandUpdate  = Command{Kind: "update", RoutingKey: "update.key", Queue: "queue.update"}
+	CommandDelete  = Command{Kind: "delete", RoutingKey: "delete.key", Queue: "queue.delete"}
+	CommandRestore = Command{Kind: "restore", RoutingKey: "restore.key", Queue: "queue.restore"}
+	// CommandBulk carries a BulkImport instead of a single Book.
+	CommandBulk = Command{Kind: "bulk", RoutingKey: "bulk.key", Queue: "queue.bulk"}
+)
+
+// Commands is every command the worker has to consume.
+var Commands = []Command{CommandCreate, CommandUpdate, CommandDelete, CommandRestore, CommandBulk}
+
+// BulkImport is the body of the bulk command, applied in one transaction.
+type BulkImport []Book
+
+// The message id of a command is its operation id; the worker moves the
+// operation from pending to one of the final statuses.
+const (
+	OperationPending   = "pending"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+const (
+	EventBookCreated  = "book.created"
+	EventBookUpdated  = "book.updated"
+	EventBookDeleted  = "book.deleted"
+	EventBookRestored = "book.restored"
+)
+
+// BookEvent is published by the worker after a change commits, with Type
+// as the routing key. Id grows monotonically and is what subscribers send
+// back as Last-Event-ID. Book holds the new state and is empty for
+// deletions. Actor is the principal that asked for the change.
+type BookEvent struct {
+	Id        int64     `json:"id"`
+	Type      string    `json:"type"`
+	BookId    int       `json:"book_id"`
+	Version   int       `json:"version,omitempty"`
+	Book      *Book     `json:"book,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Encode and Decode are the wire format of every message body.
+func Encode(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func Decode[T any](body []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(body, &v)
+	return v, err
+}
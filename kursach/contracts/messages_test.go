@@ -0,0 +1,96 @@
+package contracts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	created = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	book    = Book{
+		Id:          7,
+		Title:       "Мастер и Маргарита",
+		Authors:     []string{"Михаил Булгаков"},
+		ISBN:        "9785170987652",
+		Year:        1967,
+		Language:    "ru",
+		Tags:        []string{"роман"},
+		Description: "Сатана приезжает в Москву.",
+		Version:     3,
+	}
+)
+
+func roundTrip[T any](t *testing.T, msg T, wire string) {
+	t.Helper()
+	body, err := Encode(msg)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if string(body) != wire {
+		t.Errorf("wire format changed:\n got %s\nwant %s", body, wire)
+	}
+	got, err := Decode[T](body)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("round trip changed the message:\n got %+v\nwant %+v", got, msg)
+	}
+}
+
+func TestBookRoundTrip(t *testing.T) {
+	roundTrip(t, book,
+		`{"id":7,"title":"Мастер и Маргарита","authors":["Михаил Булгаков"],"isbn":"9785170987652","year":1967,"language":"ru","tags":["роман"],"description":"Сатана приезжает в Москву.","version":3}`)
+}
+
+func TestDeleteCommandRoundTrip(t *testing.T) {
+	roundTrip(t, Book{Id: 7},
+		`{"id":7,"title":"","authors":null,"tags":null,"description":""}`)
+}
+
+func TestTrashedBookRoundTrip(t *testing.T) {
+	b := book
+	b.DeletedAt = &created
+	body, err := Encode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode[Book](body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DeletedAt == nil || !got.DeletedAt.Equal(created) {
+		t.Errorf("deleted_at = %v, want %v", got.DeletedAt, created)
+	}
+}
+
+func TestBulkImportRoundTrip(t *testing.T) {
+	second := Book{Title: "Собачье сердце", Authors: []string{"Михаил Булгаков"}, Tags: []string{}}
+	roundTrip(t, BulkImport{book, second},
+		`[{"id":7,"title":"Мастер и Маргарита","authors":["Михаил Булгаков"],"isbn":"9785170987652","year":1967,"language":"ru","tags":["роман"],"description":"Сатана приезжает в Москву.","version":3},`+
+			`{"id":0,"title":"Собачье сердце","authors":["Михаил Булгаков"],"tags":[],"description":""}]`)
+}
+
+func TestBookEventRoundTrip(t *testing.T) {
+	b := book
+	roundTrip(t, BookEvent{Id: 42, Type: EventBookUpdated, BookId: 7, Version: 3, Book: &b, Actor: "jwt:alice", CreatedAt: created},
+		`{"id":42,"type":"book.updated","book_id":7,"version":3,"book":{"id":7,"title":"Мастер и Маргарита","authors":["Михаил Булгаков"],"isbn":"9785170987652","year":1967,"language":"ru","tags":["роман"],"description":"Сатана приезжает в Москву.","version":3},"actor":"jwt:alice","created_at":"2024-03-01T12:30:00Z"}`)
+}
+
+func TestDeletedEventRoundTrip(t *testing.T) {
+	roundTrip(t, BookEvent{Id: 43, Type: EventBookDeleted, BookId: 7, Version: 4, CreatedAt: created},
+		`{"id":43,"type":"book.deleted","book_id":7,"version":4,"created_at":"2024-03-01T12:30:00Z"}`)
+}
+
+func TestCommandsAreDistinct(t *testing.T) {
+	seen := map[string]bool{}
+	for _, c := range Commands {
+		for _, name := range []string{c.Kind, c.RoutingKey, c.Queue} {
+			if name == "" || seen[name] {
+				t.Errorf("command %+v: %q is empty or reused", c, name)
+			}
+			seen[name] = true
+		}
+	}
+}
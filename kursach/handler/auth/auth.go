@@ -0,0 +1,126 @@
+// Package auth identifies callers of the library API. It accepts JWT
+// bearer tokens signed with a key from a local JWKS file and API keys whose
+// SHA-256 hashes are kept in the api_keys table.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"platform/principal"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+const (
+	KindJWT    = "jwt"
+	KindAPIKey = "api_key"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is the authenticated caller together with its roles.
+type Principal = principal.Principal
+
+type contextKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator checks credentials. Keys may be nil, in which case only API
+// keys are accepted.
+type Authenticator struct {
+	Keys     *KeySet
+	Db       *sql.DB
+	Issuer   string
+	Audience string
+}
+
+// Authenticate checks a bearer token from the Authorization header value or
+// an API key, whichever is present.
+func (a *Authenticator) Authenticate(ctx context.Context, authorization, apiKey string) (Principal, error) {
+	if token, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+		return a.verifyToken(strings.TrimSpace(token))
+	}
+	if authorization != "" {
+		return Principal{}, fmt.Errorf("%w: unsupported authorization scheme", ErrInvalidCredentials)
+	}
+	if apiKey != "" {
+		return a.lookupKey(ctx, apiKey)
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+func (a *Authenticator) verifyToken(token string) (Principal, error) {
+	if a.Keys == nil {
+		return Principal{}, fmt.Errorf("%w: bearer tokens are not configured", ErrInvalidCredentials)
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if a.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.Issuer))
+	}
+	if a.Audience != "" {
+		opts = append(opts, jwt.WithAudience(a.Audience))
+	}
+
+	var claims tokenClaims
+	if _, err := jwt.ParseWithClaims(token, &claims, a.Keys.keyFunc, opts...); err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if claims.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	return Principal{Subject: claims.Subject, Kind: KindJWT, Roles: principal.KnownRoles(claims.Roles)}, nil
+}
+
+// tokenClaims are the registered claims plus the roles of the caller.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+func (a *Authenticator) lookupKey(ctx context.Context, key string) (Principal, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	var p Principal
+	err := a.Db.QueryRowContext(ctx,
+		`SELECT subject, roles FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`, HashKey(key),
+	).Scan(&p.Subject, pq.Array(&p.Roles))
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return p, err
+	}
+	p.Kind = KindAPIKey
+	p.Roles = principal.KnownRoles(p.Roles)
+	return p, nil
+}
+
+// HashKey is how API keys are stored: only the hash ever reaches the
+// database.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
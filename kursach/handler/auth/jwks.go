@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// KeySet holds the verification keys of a JWKS document by key id. Only
+// "oct" keys for HS256 and "RSA" keys for RS256 are understood.
+type KeySet struct {
+	hmac map[string][]byte
+	rsa  map[string]*rsa.PublicKey
+}
+
+// LoadJWKS reads a JWKS file from disk.
+func LoadJWKS(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	ks := &KeySet{hmac: map[string][]byte{}, rsa: map[string]*rsa.PublicKey{}}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) < 32 {
+				return nil, fmt.Errorf("jwks key %q: HS256 secret must be at least 32 bytes of base64url", k.Kid)
+			}
+			ks.hmac[k.Kid] = secret
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("jwks key %q: bad modulus", k.Kid)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("jwks key %q: bad exponent", k.Kid)
+			}
+			ks.rsa[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		}
+	}
+	if len(ks.hmac)+len(ks.rsa) == 0 {
+		return nil, errors.New("jwks has no usable signing keys")
+	}
+	return ks, nil
+}
+
+// keyFunc picks the key named by the token's kid. The key type has to match
+// the algorithm, so an RSA public key can never be used as an HMAC secret.
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	switch token.Method.Alg() {
+	case "HS256":
+		if key, ok := ks.hmac[kid]; ok {
+			return key, nil
+		}
+	case "RS256":
+		if key, ok := ks.rsa[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s key with kid %q", token.Method.Alg(), kid)
+}
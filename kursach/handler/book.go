@@ -1,6 +1,118 @@
 package handler
 
-type Book struct {
-	Id          int    `json:"id"`
-	Description string `json:"description"`
+import (
+	"contracts"
+	"encoding/json"
+	"time"
+)
+
+// Book is shared with the worker; see the contracts module.
+type Book = contracts.Book
+
+type BookPage struct {
+	Items         []Book `json:"items"`
+	NextCursor    string `json:"next_cursor,omitempty"`
+	TotalEstimate int64  `json:"total_estimate"`
+}
+
+type SearchHit struct {
+	Book
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+const (
+	OperationPending   = contracts.OperationPending
+	OperationSucceeded = contracts.OperationSucceeded
+	OperationFailed    = contracts.OperationFailed
+)
+
+// Operation tracks a command sent to the worker. The worker moves it out
+// of pending once the command has been applied or rejected.
+type Operation struct {
+	Id     string `json:"id"`
+	Kind   string `json:"kind"`
+	Status string `json:"status"`
+	BookId *int   `json:"book_id,omitempty"`
+	// BookIds are the books a bulk import created, in upload order.
+	BookIds []int  `json:"book_ids,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// StatusCode is the HTTP status that matches the outcome, e.g. 412
+	// when an update lost the race against a newer version.
+	StatusCode int       `json:"status_code,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+const (
+	BulkAccepted = "accepted"
+	BulkRejected = "rejected"
+)
+
+// BulkLine is the outcome of one imported record. Accepted lines point at
+// the operation of the batch they were queued in.
+type BulkLine struct {
+	Line      int          `json:"line"`
+	Status    string       `json:"status"`
+	Operation string       `json:"operation,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+type BulkReport struct {
+	Accepted   int        `json:"accepted"`
+	Rejected   int        `json:"rejected"`
+	Operations []string   `json:"operations"`
+	Lines      []BulkLine `json:"lines"`
+}
+
+const (
+	EventBookCreated  = contracts.EventBookCreated
+	EventBookUpdated  = contracts.EventBookUpdated
+	EventBookDeleted  = contracts.EventBookDeleted
+	EventBookRestored = contracts.EventBookRestored
+)
+
+type BookEvent = contracts.BookEvent
+
+// AuditEntry is one command applied by the worker. Before and After are the
+// book as it was and as it became, raw JSON so bulk imports can keep the
+// whole batch; either is null when there was no such state.
+type AuditEntry struct {
+	Id        int64           `json:"id"`
+	Operation string          `json:"operation"`
+	BookId    *int            `json:"book_id,omitempty"`
+	Actor     string          `json:"actor,omitempty"`
+	MessageId string          `json:"message_id,omitempty"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type AuditPage struct {
+	Items      []AuditEntry `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// Revision is the state of a book's fields at one version. Versions bumped
+// by a delete or restore leave no revision, so numbers may have gaps.
+type Revision struct {
+	Rev       int       `json:"rev"`
+	Book      Book      `json:"book"`
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// RevisionDiff lists the fields that differ between Against and Rev.
+// Against is empty for the first revision.
+type RevisionDiff struct {
+	BookId  int           `json:"book_id"`
+	Rev     int           `json:"rev"`
+	Against *int          `json:"against"`
+	Changes []FieldChange `json:"changes"`
 }
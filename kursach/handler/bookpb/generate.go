@@ -0,0 +1,5 @@
+// Package bookpb holds the protobuf messages and the gRPC BookService
+// generated from book.proto.
+package bookpb
+
+//go:generate protoc -I .. --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative bookpb/book.proto
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"handler/auth"
+	"log"
+	"os"
+	"platform/config"
+	"platform/principal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: apikey create <name> <subject> [reader|editor|admin,...] | revoke <id> | list")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	// Только секция БД из окружения или CONFIG_FILE: аргументы заняты командой
+	var cfg struct {
+		DB config.Postgres `yaml:"db"`
+	}
+	if err := config.Load(&cfg, nil); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", cfg.DB.DSN())
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	switch os.Args[1] {
+	case "create":
+		if len(os.Args) != 4 && len(os.Args) != 5 {
+			usage()
+		}
+		roles := []string{principal.RoleReader}
+		if len(os.Args) == 5 {
+			roles = strings.Split(os.Args[4], ",")
+			if len(principal.KnownRoles(roles)) != len(roles) {
+				usage()
+			}
+		}
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			log.Fatalf("generate key: %v", err)
+		}
+		key := "lib_" + base64.RawURLEncoding.EncodeToString(raw)
+
+		var id int64
+		err := db.QueryRow(`INSERT INTO api_keys (name, subject, key_hash, roles) VALUES ($1, $2, $3, $4) RETURNING id`,
+			os.Args[2], os.Args[3], auth.HashKey(key), pq.Array(roles)).Scan(&id)
+		if err != nil {
+			log.Fatalf("create key: %v", err)
+		}
+		// Ключ показываем один раз, в базе остаётся только хэш
+		fmt.Printf("id: %d\nkey: %s\n", id, key)
+	case "revoke":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		id, err := strconv.ParseInt(os.Args[2], 10, 64)
+		if err != nil {
+			usage()
+		}
+		res, err := db.Exec(`UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+		if err != nil {
+			log.Fatalf("revoke key: %v", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			log.Fatalf("key %d does not exist or is already revoked", id)
+		}
+	case "list":
+		rows, err := db.Query(`SELECT id, name, subject, roles, created_at, revoked_at FROM api_keys ORDER BY id`)
+		if err != nil {
+			log.Fatalf("list keys: %v", err)
+		}
+		defer rows.Close()
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSUBJECT\tROLES\tCREATED AT\tREVOKED AT")
+		for rows.Next() {
+			var id int64
+			var name, subject string
+			var roles []string
+			var created time.Time
+			var revoked sql.NullTime
+			if err := rows.Scan(&id, &name, &subject, pq.Array(&roles), &created, &revoked); err != nil {
+				log.Fatalf("list keys: %v", err)
+			}
+			r := ""
+			if revoked.Valid {
+				r = revoked.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", id, name, subject, strings.Join(roles, ","), created.Format("2006-01-02 15:04:05"), r)
+		}
+		if err := rows.Err(); err != nil {
+			log.Fatalf("list keys: %v", err)
+		}
+		w.Flush()
+	default:
+		usage()
+	}
+}
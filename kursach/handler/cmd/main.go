@@ -2,11 +2,23 @@ package main
 
 import (
 	"context"
+	"contracts"
 	"database/sql"
 	"fmt"
+	"handler/auth"
+	"handler/bookpb"
+	"handler/openapi"
 	"handler/tracer"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"platform/broker"
+	"platform/config"
+	"platform/health"
+	"platform/migrations"
+	"platform/principal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,12 +28,46 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rabbitmq/amqp091-go"
 	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
 )
 
+// Config собирается из значений по умолчанию, YAML-файла, окружения и
+// флагов, см. platform/config
+type Config struct {
+	Port        int             `yaml:"port" env:"APP_PORT" flag:"port" default:"8080"`
+	GRPCPort    int             `yaml:"grpc_port" env:"GRPC_PORT" flag:"grpc-port" default:"50051"`
+	MetricsPort int             `yaml:"metrics_port" env:"METRICS_PORT" flag:"metrics-port" default:"9100"`
+	DB          config.Postgres `yaml:"db"`
+	Redis       config.Redis    `yaml:"redis"`
+	RabbitMQ    config.RabbitMQ `yaml:"rabbitmq"`
+	JWT         struct {
+		JWKSFile string `yaml:"jwks_file" env:"JWKS_FILE" usage:"JWKS с ключами подписи токенов"`
+		Issuer   string `yaml:"issuer" env:"JWT_ISSUER"`
+		Audience string `yaml:"audience" env:"JWT_AUDIENCE"`
+	} `yaml:"jwt"`
+	// PrincipalKey подписывает автора команд для воркера
+	PrincipalKey string `yaml:"principal_key" env:"PRINCIPAL_KEY" secret:"true"`
+	// WSOrigins - сайты, с которых браузер может открыть ленту по WebSocket
+	WSOrigins []string `yaml:"ws_origins" env:"WS_ORIGINS" usage:"origin через запятую"`
+	// TrustedProxies - прокси, чьему X-Forwarded-For верим; без них клиент -
+	// это адрес соединения, иначе любой обходит лимит по адресу
+	TrustedProxies  []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"адреса или CIDR через запятую"`
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY" default:"5s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"20s"`
+}
+
+func (c *Config) Validate() error {
+	if c.ShutdownDelay < 0 || c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("неверные длительности остановки: %s, %s", c.ShutdownDelay, c.ShutdownTimeout)
+	}
+	return nil
+}
+
 var (
 	requestsCounter *prometheus.CounterVec
 	requestDuration *prometheus.HistogramVec
 	metrics         *tracer.Metrics
+	brokerMetrics   *broker.Metrics
 	registry        *prometheus.Registry
 )
 
@@ -44,6 +90,7 @@ func setupMetrics() {
 	)
 
 	metrics = tracer.NewMetrics()
+	brokerMetrics = broker.NewMetrics()
 
 	registry = prometheus.NewRegistry()
 	registry.MustRegister(
@@ -55,6 +102,9 @@ func setupMetrics() {
 		metrics.DBQueryTime,
 		metrics.CacheHit,
 		metrics.CacheMiss,
+		metrics.Throttled,
+		brokerMetrics.Up,
+		brokerMetrics.Reconnects,
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{
 			Namespace: "myapp",
 		}),
@@ -63,60 +113,51 @@ func setupMetrics() {
 }
 
 func main() {
-	setupMetrics()
+	var cfg Config
+	if err := config.Load(&cfg, os.Args[1:]); err != nil {
+		fmt.Printf("Ошибка в конфигурации: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Print("Конфигурация:\n", config.Redacted(&cfg))
 
-	var conn *amqp091.Connection
-	var err error
+	setupMetrics()
 
-	for i := 0; i < 10; i++ {
-		rabbit := os.Getenv("RB_HOST")
-		s := fmt.Sprintf("amqp://guest:guest@%s:5672", rabbit)
-		fmt.Println("Подключаюсь к RabbitMQ: ", s)
-		conn, err = amqp091.Dial(s)
-		if err != nil {
-			fmt.Println(err, "Failed to connect to RabbitMQ")
-		} else {
-			fmt.Println("Успешное подключение к RabbitMQ")
-			break
+	// Соединение с RabbitMQ восстанавливается само: после рестарта брокера
+	// каналы публикации и ленты событий открываются заново
+	mq := broker.New(cfg.RabbitMQ.URL(), "handler", brokerMetrics)
+	// Подтверждения публикаций: 202 отдаём только после того, как брокер
+	// принял команду, поэтому при остановке не теряем уже принятые запросы
+	publisher := mq.Channel(func(ch *amqp091.Channel) error {
+		if err := ch.ExchangeDeclare(contracts.Exchange, "direct", true, false, false, false, nil); err != nil {
+			return err
 		}
-		time.Sleep(3 * time.Second)
-	}
-	defer conn.Close()
+		return ch.Confirm(false)
+	})
 
-	ch, err := conn.Channel()
+	db, err := sql.Open("postgres", cfg.DB.DSN())
 	if err != nil {
-		fmt.Println("Failed to open a channel")
+		fmt.Printf("Error connecting to database: %v\n", err)
 	}
-	defer ch.Close()
 
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_NAME")
-
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-
-	db, err := sql.Open("postgres", dsn)
+	// Схема БД ведётся миграциями; при неизвестной версии схемы не стартуем
+	migrator, err := migrations.New(db)
 	if err != nil {
-		fmt.Printf("Error connecting to database: %v\n", err)
+		fmt.Printf("Ошибка при загрузке миграций: %v\n", err)
+		os.Exit(1)
 	}
-	defer db.Close()
-
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS books (
-		id SERIAL PRIMARY KEY,
-		description TEXT NOT NULL
-	);`
-
-	if _, err = db.Exec(createTableSQL); err != nil {
-		fmt.Printf("Ошибка при создании таблицы: %v\n", err)
+	if err := migrator.Up(context.Background()); err != nil {
+		fmt.Printf("Ошибка при миграции схемы: %v\n", err)
+		os.Exit(1)
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		fmt.Printf("Схема БД не совпадает с ожидаемой: %v\n", err)
+		os.Exit(1)
 	}
 
-	rd_host := os.Getenv("RD_HOST")
 	rdb := redis.NewClient(&redis.Options{
-		Addr: fmt.Sprintf("%s:6379", rd_host),
+		Addr:     cfg.Redis.Addr(),
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
 	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
 		fmt.Printf("Failed to connect to Redis: %v\n", err)
@@ -124,14 +165,72 @@ func main() {
 		fmt.Println("подключились к рэдису")
 	}
 
+	// Ключи для JWT необязательны: без JWKS_FILE принимаем только API-ключи
+	authn := &auth.Authenticator{
+		Db:       db,
+		Issuer:   cfg.JWT.Issuer,
+		Audience: cfg.JWT.Audience,
+	}
+	if cfg.JWT.JWKSFile != "" {
+		authn.Keys, err = auth.LoadJWKS(cfg.JWT.JWKSFile)
+		if err != nil {
+			fmt.Printf("Ошибка при загрузке JWKS: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	racer := tracer.Tracer{
-		Ch:      ch,
+		Ch:      publisher,
 		Db:      db,
 		Rdb:     rdb,
 		Metrics: metrics,
+		Hub:     tracer.NewEventHub(db),
+		Auth:    authn,
+
+		PrincipalKey: []byte(cfg.PrincipalKey),
+		WSOrigins:    cfg.WSOrigins,
+	}
+	if len(racer.PrincipalKey) == 0 {
+		fmt.Println("PRINCIPAL_KEY не задан: воркер отклонит команды на удаление")
+	}
+
+	// Отдельный канал для ленты событий, чтобы подписка не мешала публикации
+	mq.Channel(racer.Hub.Subscribe)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Println("Подключаюсь к RabbitMQ: ", cfg.RabbitMQ.Redacted())
+	if err := mq.Start(ctx); err != nil {
+		fmt.Printf("Не удалось подключиться к RabbitMQ: %v\n", err)
+		os.Exit(1)
+	}
+
+	spec, err := openapi.Load()
+	if err != nil {
+		fmt.Printf("Ошибка в спецификации OpenAPI: %v\n", err)
+		os.Exit(1)
+	}
+	validate, err := tracer.ValidateRequests(spec)
+	if err != nil {
+		fmt.Printf("Ошибка при создании валидатора запросов: %v\n", err)
+		os.Exit(1)
+	}
+	serveSpec, err := openapi.Spec(spec)
+	if err != nil {
+		fmt.Printf("Ошибка при сериализации спецификации: %v\n", err)
+		os.Exit(1)
 	}
 
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fmt.Printf("Ошибка в TRUSTED_PROXIES: %v\n", err)
+		os.Exit(2)
+	}
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(tracer.NotFound)
+	router.NoMethod(tracer.MethodNotAllowed)
+	router.Use(gin.CustomRecovery(tracer.Recovery))
 
 	router.Use(func(c *gin.Context) {
 		start := time.Now()
@@ -147,19 +246,128 @@ func main() {
 		requestsCounter.WithLabelValues(method, path, status).Inc()
 	})
 
-	books := router.Group("/lib")
+	router.Use(validate)
+
+	reader := tracer.Require(principal.RoleReader)
+	editor := tracer.Require(principal.RoleEditor)
+	admin := tracer.Require(principal.RoleAdmin)
+
+	// Лимит по адресу стоит до аутентификации: поток неверных ключей не
+	// должен превращаться в такое же число запросов к базе
+	books := router.Group("/lib", racer.RateLimitIP, racer.Authenticate, racer.RateLimit)
+	{
+		books.POST("", editor, racer.Idempotency, racer.Create)
+		books.GET("", reader, racer.GetAll)
+		books.PUT("", editor, racer.Idempotency, racer.Update)
+		books.DELETE("", admin, racer.Idempotency, racer.Delete)
+		books.POST("/bulk", editor, racer.Idempotency, racer.BulkImport)
+		books.GET("/search", reader, racer.Search)
+		books.GET("/export", admin, racer.Export)
+		books.GET("/operations/:id", reader, racer.GetOperation)
+		books.GET("/events", reader, racer.Events)
+		books.GET("/ws", reader, racer.EventsWS)
+		books.GET("/trash", admin, racer.Trash)
+		books.GET("/:id", reader, racer.GetOne)
+		books.POST("/:id/restore", admin, racer.Idempotency, racer.Restore)
+		books.GET("/:id/history", reader, racer.History)
+		books.GET("/:id/history/:rev/diff", reader, racer.Diff)
+		books.POST("/:id/revert/:rev", editor, racer.Idempotency, racer.Revert)
+	}
+
+	adminApi := router.Group("/admin", racer.RateLimitIP, racer.Authenticate, racer.RateLimit, admin)
 	{
-		books.POST("", racer.Create)
-		books.GET("", racer.GetAll)
-		books.PUT("", racer.Update)
-		books.DELETE("", racer.Delete)
-		books.GET("/:id", racer.GetOne)
+		adminApi.GET("/audit", racer.Audit)
+	}
+
+	// Пробы: готовность проверяет Postgres, Redis и RabbitMQ и падает во
+	// время остановки, чтобы балансировщик перестал слать новые запросы
+	probes := health.New(time.Second)
+	probes.Add("postgres", health.DB(db), 0)
+	probes.Add("redis", health.Redis(rdb), 0)
+	probes.Add("rabbitmq", health.AMQP(mq), 0)
+	router.GET("/livez", gin.WrapF(probes.Livez))
+	router.GET("/readyz", gin.WrapF(probes.Readyz))
+	router.GET("/openapi.json", serveSpec)
+	router.GET("/docs", openapi.Docs)
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+	if err != nil {
+		fmt.Printf("Ошибка при открытии порта gRPC: %v\n", err)
+		os.Exit(1)
 	}
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(tracer.UnaryAuth(&racer)),
+		grpc.StreamInterceptor(tracer.StreamAuth(&racer)),
+	)
+	bookpb.RegisterBookServiceServer(grpcServer, tracer.NewBookServer(&racer))
+	go func() {
+		fmt.Println("gRPC сервер запущен на", lis.Addr())
+		if err := grpcServer.Serve(lis); err != nil {
+			fmt.Printf("Ошибка gRPC сервера: %v\n", err)
+		}
+	}()
+
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Port), Handler: router}
+	go func() {
+		fmt.Println("Сервер запущен на", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("Ошибка при запуске сервера: %v\n", err)
+			stop()
+		}
+	}()
+
+	// Метрики отдаём на отдельном внутреннем порту без аутентификации,
+	// как и воркер: Prometheus не умеет присылать наши ключи
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	metricsSrv := &http.Server{Addr: fmt.Sprintf(":%d", cfg.MetricsPort), Handler: metricsMux}
+	go func() {
+		fmt.Println("Метрики доступны на", metricsSrv.Addr)
+		if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("Ошибка сервера метрик: %v\n", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	fmt.Println("Получен сигнал остановки, завершаю работу")
 
-	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+	probes.Drain()
+	time.Sleep(cfg.ShutdownDelay)
 
-	fmt.Println("Сервер запущен на :8080")
-	if err := http.ListenAndServe(":8080", router); err != nil {
-		fmt.Printf("Ошибка при запуске сервера: %v\n", err)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Ленты событий живут сколько угодно, их закрываем сразу: клиенты
+	// переподключатся к другому экземпляру со своим Last-Event-ID
+	racer.Hub.Close()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Не все HTTP-запросы завершились до таймаута: %v\n", err)
+	}
+	metricsSrv.Shutdown(shutdownCtx)
+
+	grpcDone := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcDone)
+	}()
+	select {
+	case <-grpcDone:
+	case <-shutdownCtx.Done():
+		fmt.Println("Не все gRPC-вызовы завершились до таймаута")
+		grpcServer.Stop()
+	}
+
+	// Запросы дождались подтверждений своих публикаций, теперь можно
+	// закрывать клиенты: сначала RabbitMQ, затем Redis и Postgres
+	if err := mq.Close(); err != nil {
+		fmt.Printf("Ошибка при закрытии соединения RabbitMQ: %v\n", err)
+	}
+	if err := rdb.Close(); err != nil {
+		fmt.Printf("Ошибка при закрытии Redis: %v\n", err)
+	}
+	if err := db.Close(); err != nil {
+		fmt.Printf("Ошибка при закрытии БД: %v\n", err)
 	}
+	fmt.Println("Сервер остановлен")
 }
@@ -0,0 +1,47 @@
+// Package openapi embeds the OpenAPI 3 document of the book service and
+// the page that renders it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+//go:embed docs.html
+var docs []byte
+
+// Load parses the embedded document and checks that it is valid OpenAPI.
+func Load() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Spec serves doc as /openapi.json.
+func Spec(doc *openapi3.T) (gin.HandlerFunc, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", data)
+	}, nil
+}
+
+// Docs serves an HTML page that renders /openapi.json.
+func Docs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docs)
+}
@@ -0,0 +1,37 @@
+package handler
+
+import "contracts"
+
+// Stable machine-readable error codes. Clients switch on these, so they
+// must not change once released.
+const (
+	CodeInvalidJSON       = "invalid_json"
+	CodeInvalidParameter  = "invalid_parameter"
+	CodeValidationFailed  = "validation_failed"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeUnauthenticated   = "unauthenticated"
+	CodeForbidden         = "forbidden"
+	CodeConflict          = "conflict"
+	CodeIdempotencyReused = "idempotency_key_reused"
+	CodeRateLimited       = "rate_limited"
+	CodeUnavailable       = "service_unavailable"
+	CodeInternal          = "internal_error"
+)
+
+// Problem is an RFC 7807 application/problem+json body. Code and Errors
+// are extension members.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError = contracts.FieldError
+
+// ValidationError lists every invalid field of a request.
+type ValidationError = contracts.ValidationError
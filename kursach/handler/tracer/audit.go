@@ -0,0 +1,147 @@
+package tracer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"handler"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditFilter narrows GET /admin/audit. From and To bound created_at,
+// From inclusive and To exclusive.
+type auditFilter struct {
+	BookId int
+	Actor  string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	After  *cursor
+}
+
+func parseAuditFilter(c *gin.Context) (auditFilter, error) {
+	f := auditFilter{Actor: strings.TrimSpace(c.Query("actor")), Limit: defaultPageLimit}
+	var errs handler.ValidationError
+
+	if s := c.Query("book_id"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil || id < 1 {
+			errs = append(errs, handler.FieldError{Field: "book_id", Message: "must be a positive integer"})
+		}
+		f.BookId = id
+	}
+	for _, p := range []struct {
+		name string
+		dest *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if s := c.Query(p.name); s != "" {
+			ts, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				errs = append(errs, handler.FieldError{Field: p.name, Message: "must be an RFC 3339 timestamp"})
+			}
+			*p.dest = ts
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			errs = append(errs, handler.FieldError{Field: "limit", Message: "must be a positive integer"})
+		}
+		f.Limit = min(limit, maxPageLimit)
+	}
+	if s := c.Query("after"); s != "" {
+		cur, err := decodeCursor(s)
+		if err != nil || cur.Sort != "audit" {
+			errs = append(errs, handler.FieldError{Field: "after", Message: "invalid cursor"})
+		}
+		f.After = cur
+	}
+
+	if len(errs) > 0 {
+		return f, errs
+	}
+	return f, nil
+}
+
+// Audit lists audit entries newest first.
+func (t *Tracer) Audit(c *gin.Context) {
+	f, err := parseAuditFilter(c)
+	if err != nil {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter, err)
+		return
+	}
+
+	var conds []string
+	var args []any
+	if f.BookId != 0 {
+		args = append(args, f.BookId)
+		conds = append(conds, fmt.Sprintf("book_id = $%d", len(args)))
+	}
+	if f.Actor != "" {
+		args = append(args, f.Actor)
+		conds = append(conds, fmt.Sprintf("actor = $%d", len(args)))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		conds = append(conds, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		conds = append(conds, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if f.After != nil {
+		args = append(args, f.After.Id)
+		conds = append(conds, fmt.Sprintf("id < $%d", len(args)))
+	}
+
+	query := "SELECT id, operation, book_id, actor, message_id, before, after, created_at FROM audit_log"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit+1)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	rows, err := t.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		unavailable(c, "failed to read audit log", err)
+		return
+	}
+	defer rows.Close()
+
+	page := handler.AuditPage{Items: []handler.AuditEntry{}}
+	for rows.Next() {
+		var e handler.AuditEntry
+		var bookId sql.NullInt64
+		var actor, msgId sql.NullString
+		var before, after []byte
+		if err := rows.Scan(&e.Id, &e.Operation, &bookId, &actor, &msgId, &before, &after, &e.CreatedAt); err != nil {
+			unavailable(c, "failed to read audit log", err)
+			return
+		}
+		if bookId.Valid {
+			id := int(bookId.Int64)
+			e.BookId = &id
+		}
+		e.Actor, e.MessageId = actor.String, msgId.String
+		e.Before, e.After = before, after
+		page.Items = append(page.Items, e)
+	}
+	if err := rows.Err(); err != nil {
+		unavailable(c, "failed to read audit log", err)
+		return
+	}
+
+	if len(page.Items) > f.Limit {
+		page.Items = page.Items[:f.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = cursor{Sort: "audit", Desc: true, Id: int(last.Id)}.encode()
+	}
+	c.JSON(http.StatusOK, page)
+}
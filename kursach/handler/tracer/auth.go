@@ -0,0 +1,111 @@
+package tracer
+
+import (
+	"context"
+	"errors"
+	"handler"
+	"handler/auth"
+	"handler/bookpb"
+	"net/http"
+	"platform/principal"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Authenticate answers 401 unless the request carries a valid bearer token
+// or X-API-Key, and puts the principal on the request context.
+func (t *Tracer) Authenticate(c *gin.Context) {
+	p, err := t.Auth.Authenticate(c.Request.Context(), c.GetHeader("Authorization"), c.GetHeader("X-API-Key"))
+	if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+		c.Header("WWW-Authenticate", `Bearer realm="library"`)
+		problem(c, http.StatusUnauthorized, handler.CodeUnauthenticated, err.Error())
+		return
+	}
+	if err != nil {
+		unavailable(c, "failed to check credentials", err)
+		return
+	}
+
+	c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+	c.Next()
+}
+
+// Require answers 403 unless the authenticated caller holds role or a
+// role above it. It runs after Authenticate.
+func Require(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, _ := auth.FromContext(c.Request.Context())
+		if !p.Has(role) {
+			problem(c, http.StatusForbidden, handler.CodeForbidden, "this action needs the "+role+" role")
+			return
+		}
+		c.Next()
+	}
+}
+
+// rpcRoles is the role each BookService method needs, matching the HTTP
+// routes. Methods missing here are refused.
+var rpcRoles = map[string]string{
+	bookpb.BookService_GetBook_FullMethodName:      principal.RoleReader,
+	bookpb.BookService_GetBooks_FullMethodName:     principal.RoleReader,
+	bookpb.BookService_ListBooks_FullMethodName:    principal.RoleReader,
+	bookpb.BookService_CreateBook_FullMethodName:   principal.RoleEditor,
+	bookpb.BookService_UpdateBook_FullMethodName:   principal.RoleEditor,
+	bookpb.BookService_GetOperation_FullMethodName: principal.RoleReader,
+	bookpb.BookService_DeleteBook_FullMethodName:   principal.RoleAdmin,
+}
+
+// UnaryAuth and StreamAuth do for gRPC what Authenticate does for HTTP,
+// reading the authorization and x-api-key metadata.
+func UnaryAuth(t *Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		ctx, err := t.authenticateRPC(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func StreamAuth(t *Tracer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		ctx, err := t.authenticateRPC(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return next(srv, &authedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context { return s.ctx }
+
+func (t *Tracer) authenticateRPC(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	p, err := t.Auth.Authenticate(ctx, first("authorization"), first("x-api-key"))
+	if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, unavailableStatus("failed to check credentials", err)
+	}
+	if role, ok := rpcRoles[method]; !ok || !p.Has(role) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not allowed for %s", method, p)
+	}
+	return auth.WithPrincipal(ctx, p), nil
+}
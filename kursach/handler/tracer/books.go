@@ -0,0 +1,25 @@
+package tracer
+
+import (
+	"handler"
+
+	"github.com/lib/pq"
+)
+
+// bookColumns is the select list that scanBook expects.
+const bookColumns = `id, title, authors, COALESCE(isbn, ''), COALESCE(year, 0),
+	language, tags, description, version`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanBook reads a row selected with bookColumns. Extra destinations are
+// scanned from the columns that follow.
+func scanBook(row rowScanner, extra ...any) (handler.Book, error) {
+	var b handler.Book
+	dest := []any{&b.Id, &b.Title, pq.Array(&b.Authors), &b.ISBN, &b.Year,
+		&b.Language, pq.Array(&b.Tags), &b.Description, &b.Version}
+	err := row.Scan(append(dest, extra...)...)
+	return b, err
+}
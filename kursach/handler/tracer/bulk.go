@@ -0,0 +1,223 @@
+package tracer
+
+import (
+	"bufio"
+	"context"
+	"contracts"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"handler"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	bulkBatchSize = 500
+	maxBulkLine   = 1 << 20
+)
+
+// csvColumns are the accepted CSV header names. Authors and tags are
+// separated by semicolons inside their cell. Id and version are accepted
+// so an export can be imported back, but they are ignored.
+var csvColumns = map[string]bool{
+	"id": true, "title": true, "authors": true, "isbn": true, "year": true,
+	"language": true, "tags": true, "description": true, "version": true,
+}
+
+// bulkImport collects valid records into batches and publishes each full
+// batch as one command while the upload is still being read.
+type bulkImport struct {
+	t      *Tracer
+	ctx    context.Context
+	report handler.BulkReport
+	books  contracts.BulkImport
+	lines  []int
+}
+
+func (b *bulkImport) add(line int, book handler.Book) {
+	book.Normalize()
+	if err := book.Validate(); err != nil {
+		var verr handler.ValidationError
+		errors.As(err, &verr)
+		b.reject(line, verr...)
+		return
+	}
+	b.books = append(b.books, book)
+	b.lines = append(b.lines, line)
+	if len(b.books) == bulkBatchSize {
+		b.flush()
+	}
+}
+
+func (b *bulkImport) reject(line int, errs ...handler.FieldError) {
+	b.report.Rejected++
+	b.report.Lines = append(b.report.Lines, handler.BulkLine{Line: line, Status: handler.BulkRejected, Errors: errs})
+}
+
+func (b *bulkImport) flush() {
+	if len(b.books) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 5*time.Second)
+	defer cancel()
+	op, err := b.t.enqueue(ctx, contracts.CommandBulk, b.books)
+	if err != nil {
+		fmt.Println("err in send bulk batch:", err)
+		for _, line := range b.lines {
+			b.reject(line, handler.FieldError{Field: "record", Message: "batch could not be queued, retry the line"})
+		}
+	} else {
+		b.report.Operations = append(b.report.Operations, op.Id)
+		b.report.Accepted += len(b.books)
+		b.t.Metrics.BooksCreated.Add(float64(len(b.books)))
+		for _, line := range b.lines {
+			b.report.Lines = append(b.report.Lines, handler.BulkLine{Line: line, Status: handler.BulkAccepted, Operation: op.Id})
+		}
+	}
+
+	b.books, b.lines = b.books[:0], b.lines[:0]
+}
+
+// BulkImport accepts a stream of books as NDJSON or as CSV with a header
+// row and answers with a per-line report.
+func (t *Tracer) BulkImport(c *gin.Context) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+
+	b := &bulkImport{
+		t:      t,
+		ctx:    c.Request.Context(),
+		report: handler.BulkReport{Operations: []string{}, Lines: []handler.BulkLine{}},
+	}
+
+	var err error
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson":
+		err = b.readNDJSON(c.Request.Body)
+	case "text/csv":
+		err = b.readCSV(c.Request.Body)
+	default:
+		problem(c, http.StatusUnsupportedMediaType, handler.CodeInvalidParameter,
+			"Content-Type must be application/x-ndjson or text/csv")
+		return
+	}
+	if err != nil {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter, err)
+		return
+	}
+	b.flush()
+
+	sort.Slice(b.report.Lines, func(i, j int) bool {
+		return b.report.Lines[i].Line < b.report.Lines[j].Line
+	})
+	c.JSON(http.StatusAccepted, b.report)
+}
+
+func (b *bulkImport) readNDJSON(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxBulkLine)
+
+	line := 0
+	for sc.Scan() {
+		line++
+		data := strings.TrimSpace(sc.Text())
+		if data == "" {
+			continue
+		}
+		var book handler.Book
+		if err := json.Unmarshal([]byte(data), &book); err != nil {
+			b.reject(line, handler.FieldError{Field: "record", Message: "invalid JSON: " + err.Error()})
+			continue
+		}
+		book.Id, book.Version = 0, 0
+		b.add(line, book)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading line %d: %w", line+1, err)
+	}
+	return nil
+}
+
+func (b *bulkImport) readCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return errors.New("CSV header row is missing")
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !csvColumns[name] {
+			return handler.ValidationError{{Field: "header", Message: fmt.Sprintf("unknown column %q", name)}}
+		}
+		columns[i] = name
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			b.reject(perr.StartLine, handler.FieldError{Field: "record", Message: perr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(record) != len(columns) {
+			b.reject(line, handler.FieldError{Field: "record", Message: fmt.Sprintf("expected %d fields, got %d", len(columns), len(record))})
+			continue
+		}
+
+		book, ferr := bookFromCSV(columns, record)
+		if ferr != nil {
+			b.reject(line, *ferr)
+			continue
+		}
+		b.add(line, book)
+	}
+}
+
+func bookFromCSV(columns, record []string) (handler.Book, *handler.FieldError) {
+	var book handler.Book
+	for i, value := range record {
+		switch columns[i] {
+		case "title":
+			book.Title = value
+		case "authors":
+			book.Authors = strings.Split(value, ";")
+		case "isbn":
+			book.ISBN = value
+		case "year":
+			if value = strings.TrimSpace(value); value != "" {
+				year, err := strconv.Atoi(value)
+				if err != nil {
+					return book, &handler.FieldError{Field: "year", Message: "must be an integer"}
+				}
+				book.Year = year
+			}
+		case "language":
+			book.Language = value
+		case "tags":
+			book.Tags = strings.Split(value, ";")
+		case "description":
+			book.Description = value
+		}
+	}
+	return book, nil
+}
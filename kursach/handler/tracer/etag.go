@@ -0,0 +1,99 @@
+package tracer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"handler"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bookCacheControl lets browsers and the CDN keep book reads but makes
+// them revalidate every time. Authentication still runs on each request,
+// and an unchanged book costs only a 304.
+const bookCacheControl = "public, no-cache"
+
+// bookETag is a strong validator built from the book id and its version.
+func bookETag(b handler.Book) string {
+	return fmt.Sprintf(`"%d.%d"`, b.Id, b.Version)
+}
+
+// pageETag changes whenever any book on the page or the page boundary does.
+func pageETag(page handler.BookPage) string {
+	sum := sha256.New()
+	for _, b := range page.Items {
+		fmt.Fprintf(sum, "%d.%d;", b.Id, b.Version)
+	}
+	sum.Write([]byte(page.NextCursor))
+	return `"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`
+}
+
+// parseIfMatch extracts the expected version of book id from an If-Match
+// header. It returns 0 when the header is empty or "*", which means the
+// update is unconditional.
+func parseIfMatch(header string, id int) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	if strings.HasPrefix(header, "W/") {
+		return 0, errors.New("If-Match requires a strong ETag")
+	}
+
+	tag := strings.Trim(header, `"`)
+	idPart, versionPart, ok := strings.Cut(tag, ".")
+	if !ok {
+		return 0, errors.New("malformed If-Match ETag")
+	}
+	tagId, err := strconv.Atoi(idPart)
+	if err != nil {
+		return 0, errors.New("malformed If-Match ETag")
+	}
+	version, err := strconv.Atoi(versionPart)
+	if err != nil || version < 1 {
+		return 0, errors.New("malformed If-Match ETag")
+	}
+	if tagId != id {
+		return 0, errors.New("If-Match ETag belongs to another book")
+	}
+	return version, nil
+}
+
+// etagMatches implements the weak comparison If-None-Match asks for.
+func etagMatches(header, etag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether a conditional GET can be answered with 304.
+// If-Modified-Since is only consulted without If-None-Match, as RFC 9110
+// requires.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,444 @@
+package tracer
+
+import (
+	"context"
+	"contracts"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"handler"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	replayBatch       = 500
+	subscriberBuffer  = 64
+	keepaliveInterval = 15 * time.Second
+)
+
+var (
+	errSlowSubscriber = errors.New("subscriber fell behind the event feed")
+	errHubClosed      = errors.New("event feed is shutting down")
+)
+
+type subscriber struct {
+	bookId int
+	ch     chan handler.BookEvent
+}
+
+// EventHub fans the events coming from RabbitMQ out to the SSE and
+// WebSocket subscribers of this instance. Missed events are replayed from
+// the book_events table.
+type EventHub struct {
+	db     *sql.DB
+	mu     sync.Mutex
+	subs   map[*subscriber]struct{}
+	closed bool
+
+	// lastSeen is the id of the last event broadcast. The worker commits
+	// events in id order but publishes them concurrently, so dispatch
+	// fills gaps from book_events and drops stragglers.
+	dispatchMu sync.Mutex
+	lastSeen   int64
+}
+
+func NewEventHub(db *sql.DB) *EventHub {
+	return &EventHub{db: db, subs: map[*subscriber]struct{}{}}
+}
+
+// Subscribe binds a queue of this instance to the events exchange and
+// starts dispatching from it. It is the setup of a managed channel, so it
+// runs again after the broker connection recovers. Events published while
+// the connection was down are read from book_events with the next one.
+func (h *EventHub) Subscribe(ch *amqp091.Channel) error {
+	err := ch.ExchangeDeclare(contracts.EventsExchange, "fanout", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("declare %s: %w", contracts.EventsExchange, err)
+	}
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return fmt.Errorf("declare events queue: %w", err)
+	}
+	if err := ch.QueueBind(q.Name, "", contracts.EventsExchange, false, nil); err != nil {
+		return fmt.Errorf("bind events queue: %w", err)
+	}
+	msgs, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("consume events: %w", err)
+	}
+	go h.dispatch(msgs)
+	return nil
+}
+
+// dispatch broadcasts events until the channel closes.
+func (h *EventHub) dispatch(msgs <-chan amqp091.Delivery) {
+	for msg := range msgs {
+		var ev handler.BookEvent
+		if err := json.Unmarshal(msg.Body, &ev); err != nil {
+			fmt.Println("error in book event:", err)
+			continue
+		}
+		h.deliver(ev)
+	}
+}
+
+// deliver broadcasts ev in id order. Events with lower ids that have not
+// arrived yet are already committed, so they are read from book_events
+// first; when they turn up later they are dropped as duplicates.
+func (h *EventHub) deliver(ev handler.BookEvent) {
+	h.dispatchMu.Lock()
+	defer h.dispatchMu.Unlock()
+	if ev.Id <= h.lastSeen {
+		return
+	}
+	if h.lastSeen != 0 && ev.Id > h.lastSeen+1 && h.hasSubscribers() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := h.fill(ctx, ev.Id)
+		cancel()
+		if err != nil {
+			// Subscribers reconnect with their Last-Event-ID and replay.
+			fmt.Println("error in book event gap:", err)
+			h.dropAll()
+		}
+	}
+	h.broadcast(ev)
+	h.lastSeen = ev.Id
+}
+
+// fill broadcasts the stored events between lastSeen and before.
+func (h *EventHub) fill(ctx context.Context, before int64) error {
+	for {
+		events, err := h.since(ctx, h.lastSeen, 0)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if ev.Id >= before {
+				return nil
+			}
+			h.broadcast(ev)
+			h.lastSeen = ev.Id
+		}
+		if len(events) < replayBatch {
+			return nil
+		}
+	}
+}
+
+func (h *EventHub) hasSubscribers() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs) > 0
+}
+
+// dropAll disconnects every subscriber without closing the hub.
+func (h *EventHub) dropAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
+
+// broadcast never blocks: a subscriber whose buffer is full is dropped and
+// has to reconnect with its Last-Event-ID.
+func (h *EventHub) broadcast(ev handler.BookEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if s.bookId != 0 && s.bookId != ev.BookId {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			delete(h.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+func (h *EventHub) subscribe(bookId int) *subscriber {
+	s := &subscriber{bookId: bookId, ch: make(chan handler.BookEvent, subscriberBuffer)}
+	h.mu.Lock()
+	if h.closed {
+		close(s.ch)
+	} else {
+		h.subs[s] = struct{}{}
+	}
+	h.mu.Unlock()
+	return s
+}
+
+func (h *EventHub) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
+
+// Close ends every stream so long-lived SSE and WebSocket requests do not
+// hold up a graceful shutdown. Clients reconnect with their Last-Event-ID.
+func (h *EventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
+
+func (h *EventHub) isClosed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+// since reads up to replayBatch stored events after the given id.
+func (h *EventHub) since(ctx context.Context, after int64, bookId int) ([]handler.BookEvent, error) {
+	query := `SELECT id, type, book_id, version, book, actor, created_at FROM book_events WHERE id > $1`
+	args := []any{after}
+	if bookId != 0 {
+		args = append(args, bookId)
+		query += " AND book_id = $2"
+	}
+	args = append(args, replayBatch)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d", len(args))
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []handler.BookEvent
+	for rows.Next() {
+		var ev handler.BookEvent
+		var book []byte
+		var actor sql.NullString
+		if err := rows.Scan(&ev.Id, &ev.Type, &ev.BookId, &ev.Version, &book, &actor, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		ev.Actor = actor.String
+		if book != nil {
+			ev.Book = &handler.Book{}
+			if err := json.Unmarshal(book, ev.Book); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// stream sends the events after lastId and then the live ones until ctx
+// ends. It subscribes before replaying so nothing published in between
+// is lost, and skips live events the replay already covered; that is safe
+// because events become visible and are delivered in id order. keepalive
+// runs when the feed has been idle for a while.
+func (h *EventHub) stream(ctx context.Context, lastId int64, bookId int,
+	send func(handler.BookEvent) error, keepalive func() error) error {
+
+	sub := h.subscribe(bookId)
+	defer h.unsubscribe(sub)
+
+	if lastId > 0 {
+		for {
+			events, err := h.since(ctx, lastId, bookId)
+			if err != nil {
+				return err
+			}
+			for _, ev := range events {
+				if err := send(ev); err != nil {
+					return err
+				}
+				lastId = ev.Id
+			}
+			if len(events) < replayBatch {
+				break
+			}
+		}
+	}
+
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := keepalive(); err != nil {
+				return err
+			}
+		case ev, ok := <-sub.ch:
+			if !ok {
+				if h.isClosed() {
+					return errHubClosed
+				}
+				return errSlowSubscriber
+			}
+			if ev.Id <= lastId {
+				continue
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+			lastId = ev.Id
+		}
+	}
+}
+
+// parseEventsQuery reads the book_id filter and the resume point, taken
+// from the Last-Event-ID header or, for clients that cannot set headers,
+// the last_event_id parameter.
+func parseEventsQuery(c *gin.Context) (int64, int, error) {
+	var bookId int
+	if s := c.Query("book_id"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil || id < 1 {
+			return 0, 0, handler.ValidationError{{Field: "book_id", Message: "must be a positive integer"}}
+		}
+		bookId = id
+	}
+
+	s := c.GetHeader("Last-Event-ID")
+	if s == "" {
+		s = c.Query("last_event_id")
+	}
+	var lastId int64
+	if s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id < 0 {
+			return 0, 0, handler.ValidationError{{Field: "Last-Event-ID", Message: "must be a non-negative integer"}}
+		}
+		lastId = id
+	}
+	return lastId, bookId, nil
+}
+
+// Events serves the change feed as Server-Sent Events.
+func (t *Tracer) Events(c *gin.Context) {
+	lastId, bookId, err := parseEventsQuery(c)
+	if err != nil {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	send := func(ev handler.BookEvent) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.Id, ev.Type, data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	keepalive := func() error {
+		if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	err = t.Hub.stream(c.Request.Context(), lastId, bookId, send, keepalive)
+	if err != nil {
+		fmt.Println("event stream closed:", err)
+	}
+}
+
+// checkOrigin lets browsers open the feed from this host or one of
+// WSOrigins. The feed needs the same credentials as GET /lib, and the
+// origin check keeps other sites from riding on them. Clients that send
+// no Origin are not browsers and are let through.
+func (t *Tracer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range t.WSOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// EventsWS serves the same feed as Events over a WebSocket, one JSON
+// event per text message.
+func (t *Tracer) EventsWS(c *gin.Context) {
+	lastId, bookId, err := parseEventsQuery(c)
+	if err != nil {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter, err)
+		return
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: t.checkOrigin}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already answered the client.
+		fmt.Println("error in websocket upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	// Clients only read; the read loop notices when they go away.
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(ev handler.BookEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(ev)
+	}
+	keepalive := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+	}
+
+	err = t.Hub.stream(ctx, lastId, bookId, send, keepalive)
+	if err != nil {
+		fmt.Println("event stream closed:", err)
+		code := websocket.CloseTryAgainLater
+		if errors.Is(err, errHubClosed) {
+			code = websocket.CloseGoingAway
+		}
+		msg := websocket.FormatCloseMessage(code, err.Error())
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		return
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
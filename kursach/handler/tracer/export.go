@@ -0,0 +1,199 @@
+package tracer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"handler"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const exportFetchSize = 500
+
+var exportFormats = map[string]string{
+	"ndjson": "application/x-ndjson",
+	"csv":    "text/csv; charset=utf-8",
+	"json":   "application/json",
+}
+
+// bookEncoder writes exported books one at a time in a single format.
+type bookEncoder interface {
+	begin() error
+	write(b handler.Book) error
+	end() error
+}
+
+// Export streams the catalogue from a server-side cursor, so memory use
+// does not depend on the number of books. It accepts the listing filters.
+func (t *Tracer) Export(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		t.Metrics.DBQueryTime.Observe(time.Since(start).Seconds())
+	}()
+
+	format := c.DefaultQuery("format", "ndjson")
+	contentType, ok := exportFormats[format]
+	if !ok {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter,
+			handler.ValidationError{{Field: "format", Message: "must be ndjson, csv or json"}})
+		return
+	}
+	filter, err := parseListFilter(c)
+	if err != nil {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := t.Db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		unavailable(c, "failed to start export", err)
+		return
+	}
+	defer tx.Rollback()
+
+	conds, args := filter.conditions(nil)
+	query := "DECLARE export_cursor NO SCROLL CURSOR FOR SELECT " + bookColumns + " FROM books"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY id"
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		unavailable(c, "failed to start export", err)
+		return
+	}
+
+	filename := fmt.Sprintf("books-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	var enc bookEncoder
+	switch format {
+	case "ndjson":
+		enc = &ndjsonEncoder{enc: json.NewEncoder(c.Writer)}
+	case "csv":
+		enc = &csvEncoder{w: csv.NewWriter(c.Writer)}
+	case "json":
+		enc = &jsonArrayEncoder{w: c.Writer}
+	}
+
+	// The status line is already sent, so a failure from here on can only
+	// cut the stream short.
+	if err := streamCursor(ctx, tx, enc, c.Writer.Flush); err != nil {
+		fmt.Println("export interrupted:", err)
+		c.Abort()
+	}
+}
+
+func streamCursor(ctx context.Context, tx *sql.Tx, enc bookEncoder, flush func()) error {
+	if err := enc.begin(); err != nil {
+		return err
+	}
+	for {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH %d FROM export_cursor", exportFetchSize))
+		if err != nil {
+			return err
+		}
+		n := 0
+		for rows.Next() {
+			book, err := scanBook(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if err := enc.write(book); err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		flush()
+		if n < exportFetchSize {
+			break
+		}
+	}
+	if err := enc.end(); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) begin() error               { return nil }
+func (e *ndjsonEncoder) write(b handler.Book) error { return e.enc.Encode(b) }
+func (e *ndjsonEncoder) end() error                 { return nil }
+
+type jsonArrayEncoder struct {
+	w     http.ResponseWriter
+	count int
+}
+
+func (e *jsonArrayEncoder) begin() error {
+	_, err := e.w.Write([]byte("["))
+	return err
+}
+
+func (e *jsonArrayEncoder) write(b handler.Book) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		data = append([]byte(","), data...)
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonArrayEncoder) end() error {
+	_, err := e.w.Write([]byte("]\n"))
+	return err
+}
+
+// csvEncoder uses the same columns as the CSV bulk import plus id and
+// version, so an export can be fed back in.
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) begin() error {
+	return e.w.Write([]string{"id", "title", "authors", "isbn", "year", "language", "tags", "description", "version"})
+}
+
+func (e *csvEncoder) write(b handler.Book) error {
+	year := ""
+	if b.Year != 0 {
+		year = strconv.Itoa(b.Year)
+	}
+	err := e.w.Write([]string{
+		strconv.Itoa(b.Id), b.Title, strings.Join(b.Authors, ";"), b.ISBN, year,
+		b.Language, strings.Join(b.Tags, ";"), b.Description, strconv.Itoa(b.Version),
+	})
+	if err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
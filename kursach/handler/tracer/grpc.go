@@ -0,0 +1,275 @@
+package tracer
+
+import (
+	"context"
+	"contracts"
+	"database/sql"
+	"errors"
+	"fmt"
+	"handler"
+	"handler/bookpb"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// BookServer serves bookpb.BookService on top of the same queue, database
+// and cache as the HTTP handlers.
+type BookServer struct {
+	bookpb.UnimplementedBookServiceServer
+	t *Tracer
+}
+
+func NewBookServer(t *Tracer) *BookServer {
+	return &BookServer{t: t}
+}
+
+func (s *BookServer) CreateBook(ctx context.Context, req *bookpb.CreateBookRequest) (*bookpb.Operation, error) {
+	book := bookFromProto(req.GetBook())
+	book.Normalize()
+	if err := book.Validate(); err != nil {
+		return nil, grpcError(err)
+	}
+
+	op, err := s.t.enqueue(ctx, contracts.CommandCreate, book)
+	if err != nil {
+		return nil, unavailableStatus("failed to queue create", err)
+	}
+	s.t.Metrics.BooksCreated.Inc()
+	return operationToProto(op), nil
+}
+
+func (s *BookServer) UpdateBook(ctx context.Context, req *bookpb.UpdateBookRequest) (*bookpb.Operation, error) {
+	book := bookFromProto(req.GetBook())
+	book.Normalize()
+	if err := book.Validate(); err != nil {
+		return nil, grpcError(err)
+	}
+	if book.Id < 1 {
+		return nil, grpcError(handler.ValidationError{{Field: "book.id", Message: "book id is required"}})
+	}
+	if req.GetExpectedVersion() != 0 {
+		book.Version = int(req.GetExpectedVersion())
+	}
+
+	op, err := s.t.enqueue(ctx, contracts.CommandUpdate, book)
+	if err != nil {
+		return nil, unavailableStatus("failed to queue update", err)
+	}
+	return operationToProto(op), nil
+}
+
+func (s *BookServer) DeleteBook(ctx context.Context, req *bookpb.DeleteBookRequest) (*bookpb.Operation, error) {
+	if req.GetId() < 1 {
+		return nil, grpcError(handler.ValidationError{{Field: "id", Message: "book id is required"}})
+	}
+
+	op, err := s.t.enqueue(ctx, contracts.CommandDelete, handler.Book{Id: int(req.GetId())})
+	if err != nil {
+		return nil, unavailableStatus("failed to queue delete", err)
+	}
+	return operationToProto(op), nil
+}
+
+func (s *BookServer) GetBook(ctx context.Context, req *bookpb.GetBookRequest) (*bookpb.Book, error) {
+	if req.GetId() < 1 {
+		return nil, grpcError(handler.ValidationError{{Field: "id", Message: "must be a positive integer"}})
+	}
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	book, err := s.t.loadBook(ctx, int(req.GetId()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "book %d does not exist", req.GetId())
+	}
+	if err != nil {
+		return nil, unavailableStatus("failed to load book", err)
+	}
+	return bookToProto(book), nil
+}
+
+func (s *BookServer) GetBooks(ctx context.Context, req *bookpb.GetBooksRequest) (*bookpb.BookPage, error) {
+	q := listQuery{
+		listFilter: filterFromProto(req.GetFilter()),
+		Limit:      defaultPageLimit,
+		Sort:       req.GetSort(),
+		Desc:       req.GetDesc(),
+	}
+	if q.Sort == "" {
+		q.Sort = "id"
+	}
+	if req.GetLimit() < 0 {
+		return nil, grpcError(handler.ValidationError{{Field: "limit", Message: "must be a positive integer"}})
+	}
+	if req.GetLimit() > 0 {
+		q.Limit = min(int(req.GetLimit()), maxPageLimit)
+	}
+	if _, ok := sortColumns[q.Sort]; !ok {
+		return nil, grpcError(handler.ValidationError{{Field: "sort", Message: fmt.Sprintf("unknown sort field %q", q.Sort)}})
+	}
+	if err := q.setCursor(req.GetAfter()); err != nil {
+		return nil, grpcError(err)
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+	page, err := s.t.listBooks(ctx, q)
+	if err != nil {
+		return nil, unavailableStatus("failed to list books", err)
+	}
+	page.TotalEstimate, err = s.t.estimateCount(ctx, q.listFilter)
+	if err != nil {
+		fmt.Println("error in count estimate:", err)
+	}
+
+	resp := &bookpb.BookPage{NextCursor: page.NextCursor, TotalEstimate: page.TotalEstimate}
+	for _, b := range page.Items {
+		resp.Items = append(resp.Items, bookToProto(b))
+	}
+	return resp, nil
+}
+
+// ListBooks walks the matching books in id order, one keyset page at a
+// time, so the stream never holds more than a page in memory. It runs for
+// as long as the client's deadline allows.
+func (s *BookServer) ListBooks(req *bookpb.ListBooksRequest, stream bookpb.BookService_ListBooksServer) error {
+	ctx := stream.Context()
+	q := listQuery{
+		listFilter: filterFromProto(req.GetFilter()),
+		Limit:      maxPageLimit,
+		Sort:       "id",
+	}
+
+	for {
+		page, err := s.t.listBooks(ctx, q)
+		if err != nil {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return unavailableStatus("failed to list books", err)
+		}
+		for _, b := range page.Items {
+			if err := stream.Send(bookToProto(b)); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		q.After = &cursor{Sort: q.Sort, Id: page.Items[len(page.Items)-1].Id}
+	}
+}
+
+func (s *BookServer) GetOperation(ctx context.Context, req *bookpb.GetOperationRequest) (*bookpb.Operation, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	op, err := s.t.loadOperation(ctx, req.GetId())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "operation %s does not exist", req.GetId())
+	}
+	if err != nil {
+		return nil, unavailableStatus("failed to load operation", err)
+	}
+	return operationToProto(op), nil
+}
+
+// withDefaultTimeout keeps the client's deadline and only adds the usual
+// five seconds when the client did not set one.
+func withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, 5*time.Second)
+}
+
+// grpcError maps a ValidationError to InvalidArgument with a BadRequest
+// detail listing the fields, the same list the HTTP problem carries.
+func grpcError(err error) error {
+	var verr handler.ValidationError
+	if !errors.As(err, &verr) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	br := &errdetails.BadRequest{}
+	msgs := make([]string, 0, len(verr))
+	for _, f := range verr {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       f.Field,
+			Description: f.Message,
+		})
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	st, derr := status.New(codes.InvalidArgument, strings.Join(msgs, "; ")).WithDetails(br)
+	if derr != nil {
+		return status.Error(codes.InvalidArgument, strings.Join(msgs, "; "))
+	}
+	return st.Err()
+}
+
+func unavailableStatus(what string, err error) error {
+	fmt.Printf("%s: %v\n", what, err)
+	return status.Error(codes.Unavailable, what)
+}
+
+func bookFromProto(b *bookpb.Book) handler.Book {
+	return handler.Book{
+		Id:          int(b.GetId()),
+		Title:       b.GetTitle(),
+		Authors:     b.GetAuthors(),
+		ISBN:        b.GetIsbn(),
+		Year:        int(b.GetYear()),
+		Language:    b.GetLanguage(),
+		Tags:        b.GetTags(),
+		Description: b.GetDescription(),
+		Version:     int(b.GetVersion()),
+	}
+}
+
+func bookToProto(b handler.Book) *bookpb.Book {
+	return &bookpb.Book{
+		Id:          int64(b.Id),
+		Title:       b.Title,
+		Authors:     b.Authors,
+		Isbn:        b.ISBN,
+		Year:        int32(b.Year),
+		Language:    b.Language,
+		Tags:        b.Tags,
+		Description: b.Description,
+		Version:     int64(b.Version),
+	}
+}
+
+func filterFromProto(f *bookpb.BookFilter) listFilter {
+	return listFilter{
+		Title:       strings.TrimSpace(f.GetTitle()),
+		Description: strings.TrimSpace(f.GetDescription()),
+		Author:      strings.TrimSpace(f.GetAuthor()),
+		Tag:         strings.ToLower(strings.TrimSpace(f.GetTag())),
+		Language:    strings.ToLower(strings.TrimSpace(f.GetLanguage())),
+		Year:        int(f.GetYear()),
+	}
+}
+
+func operationToProto(op handler.Operation) *bookpb.Operation {
+	pb := &bookpb.Operation{
+		Id:         op.Id,
+		Kind:       op.Kind,
+		Status:     op.Status,
+		Error:      op.Error,
+		StatusCode: int32(op.StatusCode),
+		CreatedAt:  timestamppb.New(op.CreatedAt),
+		UpdatedAt:  timestamppb.New(op.UpdatedAt),
+	}
+	if op.BookId != nil {
+		pb.BookId = int64(*op.BookId)
+	}
+	for _, id := range op.BookIds {
+		pb.BookIds = append(pb.BookIds, int64(id))
+	}
+	return pb
+}
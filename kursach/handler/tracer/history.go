@@ -0,0 +1,232 @@
+package tracer
+
+import (
+	"context"
+	"contracts"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"handler"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// History lists every stored revision of a book, newest first.
+func (t *Tracer) History(c *gin.Context) {
+	id, ok := bookIdParam(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	rows, err := t.Db.QueryContext(ctx, `
+	SELECT version, book, actor, created_at FROM book_revisions
+	WHERE book_id = $1 ORDER BY version DESC`, id)
+	if err != nil {
+		unavailable(c, "failed to load history", err)
+		return
+	}
+	defer rows.Close()
+
+	revs := []handler.Revision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			unavailable(c, "failed to load history", err)
+			return
+		}
+		revs = append(revs, rev)
+	}
+	if err := rows.Err(); err != nil {
+		unavailable(c, "failed to load history", err)
+		return
+	}
+	if len(revs) == 0 {
+		problem(c, http.StatusNotFound, handler.CodeNotFound, fmt.Sprintf("book %d has no history", id))
+		return
+	}
+	c.JSON(http.StatusOK, revs)
+}
+
+// Diff compares a revision with the one before it, or with the revision
+// given in ?against=.
+func (t *Tracer) Diff(c *gin.Context) {
+	id, ok := bookIdParam(c)
+	if !ok {
+		return
+	}
+	rev, ok := revParam(c)
+	if !ok {
+		return
+	}
+	against := 0
+	if s := c.Query("against"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter,
+				handler.ValidationError{{Field: "against", Message: "must be a positive integer"}})
+			return
+		}
+		against = n
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	cur, err := t.loadRevision(ctx, id, rev)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem(c, http.StatusNotFound, handler.CodeNotFound, fmt.Sprintf("book %d has no revision %d", id, rev))
+		return
+	}
+	if err != nil {
+		unavailable(c, "failed to load revision", err)
+		return
+	}
+
+	if against == 0 {
+		err = t.Db.QueryRowContext(ctx, `
+		SELECT version FROM book_revisions WHERE book_id = $1 AND version < $2
+		ORDER BY version DESC LIMIT 1`, id, rev).Scan(&against)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			unavailable(c, "failed to load revision", err)
+			return
+		}
+	}
+
+	diff := handler.RevisionDiff{BookId: id, Rev: rev}
+	var prev handler.Book
+	if against != 0 {
+		old, err := t.loadRevision(ctx, id, against)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem(c, http.StatusNotFound, handler.CodeNotFound, fmt.Sprintf("book %d has no revision %d", id, against))
+			return
+		}
+		if err != nil {
+			unavailable(c, "failed to load revision", err)
+			return
+		}
+		prev = old.Book
+		diff.Against = &against
+	}
+	diff.Changes = diffBooks(prev, cur.Book)
+	c.JSON(http.StatusOK, diff)
+}
+
+// Revert queues a normal update that puts the fields of a revision back.
+// It expects the current version, or the one in If-Match, so an edit that
+// lands in between makes the revert fail with 412 instead of being lost.
+func (t *Tracer) Revert(c *gin.Context) {
+	id, ok := bookIdParam(c)
+	if !ok {
+		return
+	}
+	rev, ok := revParam(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	r, err := t.loadRevision(ctx, id, rev)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem(c, http.StatusNotFound, handler.CodeNotFound, fmt.Sprintf("book %d has no revision %d", id, rev))
+		return
+	}
+	if err != nil {
+		unavailable(c, "failed to load revision", err)
+		return
+	}
+
+	book := r.Book
+	book.Id = id
+	book.Version, err = parseIfMatch(c.GetHeader("If-Match"), id)
+	if err != nil {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter,
+			handler.ValidationError{{Field: "If-Match", Message: err.Error()}})
+		return
+	}
+	if book.Version == 0 {
+		err = t.Db.QueryRowContext(ctx,
+			`SELECT version FROM books WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&book.Version)
+		if errors.Is(err, sql.ErrNoRows) {
+			problem(c, http.StatusNotFound, handler.CodeNotFound, fmt.Sprintf("book %d does not exist", id))
+			return
+		}
+		if err != nil {
+			unavailable(c, "failed to load book", err)
+			return
+		}
+	}
+
+	op, err := t.enqueue(ctx, contracts.CommandUpdate, book)
+	if err != nil {
+		unavailable(c, "failed to queue revert", err)
+		return
+	}
+	fmt.Println(" [x] Sent revert", id, "to revision", rev)
+
+	accepted(c, op)
+}
+
+func revParam(c *gin.Context) (int, bool) {
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || rev < 1 {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter,
+			handler.ValidationError{{Field: "rev", Message: "must be a positive integer"}})
+		return 0, false
+	}
+	return rev, true
+}
+
+func (t *Tracer) loadRevision(ctx context.Context, id, rev int) (handler.Revision, error) {
+	return scanRevision(t.Db.QueryRowContext(ctx, `
+	SELECT version, book, actor, created_at FROM book_revisions
+	WHERE book_id = $1 AND version = $2`, id, rev))
+}
+
+func scanRevision(row rowScanner) (handler.Revision, error) {
+	var r handler.Revision
+	var data []byte
+	var actor sql.NullString
+	if err := row.Scan(&r.Rev, &data, &actor, &r.CreatedAt); err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(data, &r.Book); err != nil {
+		return r, err
+	}
+	r.Actor = actor.String
+	return r, nil
+}
+
+// diffBooks lists the user-editable fields that differ. A missing list
+// and an empty one count as equal.
+func diffBooks(a, b handler.Book) []handler.FieldChange {
+	changes := []handler.FieldChange{}
+	add := func(field string, before, after any) {
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, handler.FieldChange{Field: field, Before: before, After: after})
+		}
+	}
+	add("title", a.Title, b.Title)
+	add("authors", nonNil(a.Authors), nonNil(b.Authors))
+	add("isbn", a.ISBN, b.ISBN)
+	add("year", a.Year, b.Year)
+	add("language", a.Language, b.Language)
+	add("tags", nonNil(a.Tags), nonNil(b.Tags))
+	add("description", a.Description, b.Description)
+	return changes
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,185 @@
+package tracer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"handler"
+	"handler/auth"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyPendingTTL bounds how long a request that never finished,
+	// e.g. because the process died, blocks retries with its key.
+	idempotencyPendingTTL = 5 * time.Minute
+)
+
+// idempotencyRecord is what Redis keeps under an Idempotency-Key. While the
+// first request is still running Status is zero and the body is not yet
+// fingerprinted.
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency replays the stored response when a mutating request is
+// retried with the same Idempotency-Key, so the command is published once.
+// Reusing a key for a different request is rejected with 422. The body is
+// hashed as it streams, so bulk uploads are never buffered.
+func (t *Tracer) Idempotency(c *gin.Context) {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" {
+		c.Next()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// Keys are scoped to the caller so two clients cannot collide.
+	rkey := "idempotency:" + key
+	if p, ok := auth.FromContext(c.Request.Context()); ok {
+		rkey = "idempotency:" + p.String() + ":" + key
+	}
+	pending, _ := json.Marshal(idempotencyRecord{})
+	fresh, err := t.Rdb.SetNX(ctx, rkey, pending, idempotencyPendingTTL).Result()
+	if err != nil {
+		unavailable(c, "idempotency store unavailable", err)
+		return
+	}
+
+	if !fresh {
+		t.replay(ctx, c, rkey)
+		return
+	}
+
+	// A panic would otherwise leave the key pending until it expires.
+	completed := false
+	defer func() {
+		if !completed {
+			t.forgetIdempotency(rkey)
+		}
+	}()
+
+	sum := requestFingerprint(c.Request)
+	body := c.Request.Body
+	tee := io.TeeReader(body, sum)
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{tee, body}
+
+	rec := &bodyRecorder{ResponseWriter: c.Writer}
+	c.Writer = rec
+	c.Next()
+
+	// Server errors are not remembered so the client can retry them.
+	if c.Writer.Status() >= http.StatusInternalServerError {
+		return
+	}
+	// The handler may stop reading early; the rest still counts.
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		log.Printf("error in idempotency body: %v", err)
+		return
+	}
+
+	done, _ := json.Marshal(idempotencyRecord{
+		Fingerprint: hex.EncodeToString(sum.Sum(nil)),
+		Status:      c.Writer.Status(),
+		ContentType: c.Writer.Header().Get("Content-Type"),
+		Location:    c.Writer.Header().Get("Location"),
+		Body:        rec.body.Bytes(),
+	})
+	if err := t.Rdb.Set(context.Background(), rkey, done, idempotencyTTL).Err(); err != nil {
+		log.Printf("error in idempotency set: %v", err)
+		return
+	}
+	completed = true
+}
+
+// requestFingerprint starts the hash that tells retries from other
+// requests: method, path and preconditions, followed by the body.
+func requestFingerprint(r *http.Request) hash.Hash {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s %s\n", r.Method, r.URL.Path)
+	for _, h := range []string{"If-Match", "If-None-Match", "If-Unmodified-Since"} {
+		fmt.Fprintf(sum, "%s: %s\n", h, r.Header.Get(h))
+	}
+	return sum
+}
+
+func (t *Tracer) forgetIdempotency(rkey string) {
+	if err := t.Rdb.Del(context.Background(), rkey).Err(); err != nil {
+		log.Printf("error in idempotency del: %v", err)
+	}
+}
+
+func (t *Tracer) replay(ctx context.Context, c *gin.Context, rkey string) {
+	raw, err := t.Rdb.Get(ctx, rkey).Bytes()
+	if err == redis.Nil {
+		problem(c, http.StatusConflict, handler.CodeConflict, "request with this Idempotency-Key expired, retry")
+		return
+	}
+	if err != nil {
+		unavailable(c, "idempotency store unavailable", err)
+		return
+	}
+
+	var stored idempotencyRecord
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		unavailable(c, "broken idempotency record", err)
+		return
+	}
+
+	if stored.Status == 0 {
+		problem(c, http.StatusConflict, handler.CodeConflict, "request with this Idempotency-Key is still in progress")
+		return
+	}
+
+	sum := requestFingerprint(c.Request)
+	if _, err := io.Copy(sum, c.Request.Body); err != nil {
+		problem(c, http.StatusBadRequest, handler.CodeInvalidJSON, "cannot read request body")
+		return
+	}
+	if stored.Fingerprint != hex.EncodeToString(sum.Sum(nil)) {
+		problem(c, http.StatusUnprocessableEntity, handler.CodeIdempotencyReused, "Idempotency-Key was already used with a different request")
+		return
+	}
+
+	if stored.Location != "" {
+		c.Header("Location", stored.Location)
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(stored.Status, stored.ContentType, stored.Body)
+	c.Abort()
+}
@@ -0,0 +1,299 @@
+package tracer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"handler"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// descriptionSortLen is how much of the description sorting looks at; a
+// btree cannot index the full text of long descriptions.
+const descriptionSortLen = 256
+
+// sortColumns maps the public sort names to book column expressions. Each
+// of them is backed by an index on (expression, id) so keyset pages stay
+// cheap.
+var sortColumns = map[string]string{
+	"id":          "id",
+	"title":       "title",
+	"description": fmt.Sprintf("left(description, %d)", descriptionSortLen),
+}
+
+// sortValue is the cursor value of b for a text sort column.
+func sortValue(column string, b handler.Book) string {
+	if column == "title" {
+		return b.Title
+	}
+	if r := []rune(b.Description); len(r) > descriptionSortLen {
+		return string(r[:descriptionSortLen])
+	}
+	return b.Description
+}
+
+// listFilter holds the filters shared by every book listing. Title,
+// description and author match substrings, the rest match exactly.
+// Deleted switches the listing from live books to the trash.
+type listFilter struct {
+	Title       string
+	Description string
+	Author      string
+	Tag         string
+	Language    string
+	Year        int
+	Deleted     bool
+}
+
+// conditions appends the filter predicates to args and returns them
+// ready to be joined with AND.
+func (f listFilter) conditions(args []any) ([]string, []any) {
+	conds := []string{"deleted_at IS NULL"}
+	if f.Deleted {
+		conds[0] = "deleted_at IS NOT NULL"
+	}
+	if f.Title != "" {
+		args = append(args, "%"+escapeLike(f.Title)+"%")
+		conds = append(conds, fmt.Sprintf("title ILIKE $%d", len(args)))
+	}
+	if f.Description != "" {
+		args = append(args, "%"+escapeLike(f.Description)+"%")
+		conds = append(conds, fmt.Sprintf("description ILIKE $%d", len(args)))
+	}
+	if f.Author != "" {
+		args = append(args, "%"+escapeLike(f.Author)+"%")
+		conds = append(conds, fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(authors) a WHERE a ILIKE $%d)", len(args)))
+	}
+	if f.Tag != "" {
+		args = append(args, f.Tag)
+		conds = append(conds, fmt.Sprintf("tags @> ARRAY[$%d]::text[]", len(args)))
+	}
+	if f.Language != "" {
+		args = append(args, f.Language)
+		conds = append(conds, fmt.Sprintf("language = $%d", len(args)))
+	}
+	if f.Year != 0 {
+		args = append(args, f.Year)
+		conds = append(conds, fmt.Sprintf("year = $%d", len(args)))
+	}
+	return conds, args
+}
+
+type listQuery struct {
+	listFilter
+	Limit int
+	Sort  string
+	Desc  bool
+	After *cursor
+}
+
+// cursor is the position of the last row of a page. It is handed to the
+// client as an opaque base64 string.
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v,omitempty"`
+	Id    int    `json:"id"`
+}
+
+func (cur cursor) encode() string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cur cursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cur, nil
+}
+
+func parseListFilter(c *gin.Context) (listFilter, error) {
+	f := listFilter{
+		Title:       strings.TrimSpace(c.Query("title")),
+		Description: strings.TrimSpace(c.Query("description")),
+		Author:      strings.TrimSpace(c.Query("author")),
+		Tag:         strings.ToLower(strings.TrimSpace(c.Query("tag"))),
+		Language:    strings.ToLower(strings.TrimSpace(c.Query("language"))),
+	}
+	if s := c.Query("year"); s != "" {
+		year, err := strconv.Atoi(s)
+		if err != nil {
+			return f, handler.ValidationError{{Field: "year", Message: "must be an integer"}}
+		}
+		f.Year = year
+	}
+	return f, nil
+}
+
+func parseListQuery(c *gin.Context) (listQuery, error) {
+	filter, err := parseListFilter(c)
+	q := listQuery{
+		listFilter: filter,
+		Limit:      defaultPageLimit,
+		Sort:       c.DefaultQuery("sort", "id"),
+	}
+	if err != nil {
+		return q, err
+	}
+
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return q, handler.ValidationError{{Field: "limit", Message: "must be a positive integer"}}
+		}
+		q.Limit = min(limit, maxPageLimit)
+	}
+
+	if _, ok := sortColumns[q.Sort]; !ok {
+		return q, handler.ValidationError{{Field: "sort", Message: fmt.Sprintf("unknown sort field %q", q.Sort)}}
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, handler.ValidationError{{Field: "order", Message: "must be asc or desc"}}
+	}
+
+	if err := q.setCursor(c.Query("after")); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+// setCursor decodes the after cursor and checks that it was issued for the
+// same sort order.
+func (q *listQuery) setCursor(after string) error {
+	if after == "" {
+		return nil
+	}
+	cur, err := decodeCursor(after)
+	if err != nil {
+		return handler.ValidationError{{Field: "after", Message: err.Error()}}
+	}
+	if cur.Sort != q.Sort || cur.Desc != q.Desc {
+		return handler.ValidationError{{Field: "after", Message: "cursor does not match the requested sort order"}}
+	}
+	q.After = cur
+	return nil
+}
+
+// listBooks returns one keyset page without the total estimate. It reads
+// limit+1 rows to find out whether another page follows without counting
+// the whole table.
+func (t *Tracer) listBooks(ctx context.Context, q listQuery) (handler.BookPage, error) {
+	page := handler.BookPage{Items: []handler.Book{}}
+
+	conds, args := q.conditions(nil)
+	column := sortColumns[q.Sort]
+	cmp, dir := ">", "ASC"
+	if q.Desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	if q.After != nil {
+		if column == "id" {
+			args = append(args, q.After.Id)
+			conds = append(conds, fmt.Sprintf("id %s $%d", cmp, len(args)))
+		} else {
+			args = append(args, q.After.Value, q.After.Id)
+			conds = append(conds, fmt.Sprintf("(%s, id) %s ($%d, $%d)", column, cmp, len(args)-1, len(args)))
+		}
+	}
+
+	query := "SELECT " + bookColumns + ", deleted_at FROM books"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if column == "id" {
+		query += fmt.Sprintf(" ORDER BY id %s", dir)
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, id %s", column, dir, dir)
+	}
+	args = append(args, q.Limit+1)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+
+	rows, err := t.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deletedAt sql.NullTime
+		book, err := scanBook(rows, &deletedAt)
+		if err != nil {
+			return page, err
+		}
+		if deletedAt.Valid {
+			book.DeletedAt = &deletedAt.Time
+		}
+		page.Items = append(page.Items, book)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Items) > q.Limit {
+		page.Items = page.Items[:q.Limit]
+		last := page.Items[len(page.Items)-1]
+		next := cursor{Sort: q.Sort, Desc: q.Desc, Id: last.Id}
+		if column != "id" {
+			next.Value = sortValue(column, last)
+		}
+		page.NextCursor = next.encode()
+	}
+
+	return page, nil
+}
+
+// estimateCount asks the planner how many rows match the filter. It is
+// only a hint, but unlike COUNT(*) its cost does not grow with the table.
+func (t *Tracer) estimateCount(ctx context.Context, f listFilter) (int64, error) {
+	conds, args := f.conditions(nil)
+	query := "EXPLAIN (FORMAT JSON) SELECT 1 FROM books"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var raw []byte
+	if err := t.Db.QueryRowContext(ctx, query, args...).Scan(&raw); err != nil {
+		return 0, err
+	}
+
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plan); err != nil {
+		return 0, err
+	}
+	if len(plan) == 0 {
+		return 0, nil
+	}
+	return int64(plan[0].Plan.Rows), nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,103 @@
+package tracer
+
+import (
+	"handler"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+// streamedBodies are not read by the validator: they can be far larger
+// than memory and BulkImport checks them line by line.
+var streamedBodies = map[string]bool{
+	"application/x-ndjson": true,
+	"application/ndjson":   true,
+	"text/csv":             true,
+}
+
+// ValidateRequests checks parameters and JSON bodies of every request that
+// matches a route of doc. Requests for routes missing from doc are left
+// to the router.
+func ValidateRequests(doc *openapi3.T) (gin.HandlerFunc, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				ExcludeRequestBody: streamedBodies[mediaType],
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			fields, inBody := specViolations(err)
+			if inBody {
+				invalid(c, http.StatusUnprocessableEntity, handler.CodeValidationFailed, fields)
+			} else {
+				invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter, fields)
+			}
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// specViolations flattens validator errors into field errors. inBody is
+// true when the body decoded but broke its schema, which is answered with
+// 422 rather than 400.
+func specViolations(err error) (fields handler.ValidationError, inBody bool) {
+	badRequest := false
+	var walk func(err error, field string, body bool)
+	walk = func(err error, field string, body bool) {
+		// A type switch, not errors.As: every layer wraps the next one and
+		// the parameter name lives on the outer RequestError.
+		switch e := err.(type) {
+		case openapi3.MultiError:
+			for _, inner := range e {
+				walk(inner, field, body)
+			}
+		case *openapi3filter.RequestError:
+			if e.Parameter != nil {
+				field = e.Parameter.Name
+			}
+			body = e.RequestBody != nil
+			if e.Err == nil {
+				badRequest = true
+				fields = append(fields, handler.FieldError{Field: field, Message: e.Reason})
+				return
+			}
+			walk(e.Err, field, body)
+		case *openapi3.SchemaError:
+			if pointer := e.JSONPointer(); len(pointer) > 0 {
+				field = strings.Join(pointer, ".")
+			}
+			if !body {
+				badRequest = true
+			}
+			fields = append(fields, handler.FieldError{Field: field, Message: e.Reason})
+		default:
+			badRequest = true
+			fields = append(fields, handler.FieldError{Field: field, Message: err.Error()})
+		}
+	}
+	walk(err, "", false)
+	return fields, !badRequest
+}
@@ -0,0 +1,148 @@
+package tracer
+
+import (
+	"context"
+	"contracts"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"handler"
+	"handler/auth"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func newOperationId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// enqueue records a pending operation and publishes the command to the
+// worker. The operation id travels as the AMQP message id so the worker can
+// report the outcome back.
+func (t *Tracer) enqueue(ctx context.Context, cmd contracts.Command, payload any) (handler.Operation, error) {
+	var op handler.Operation
+
+	jsonData, err := contracts.Encode(payload)
+	if err != nil {
+		return op, err
+	}
+
+	op.Id = newOperationId()
+
+	// The worker learns who asked for the change from the signed message
+	// headers and checks the roles again before deleting.
+	var actor sql.NullString
+	var headers amqp091.Table
+	if p, ok := auth.FromContext(ctx); ok {
+		actor = sql.NullString{String: p.String(), Valid: true}
+		headers = p.Headers(t.PrincipalKey, op.Id, jsonData)
+	}
+
+	op.Kind = cmd.Kind
+	op.Status = handler.OperationPending
+	err = t.Db.QueryRowContext(ctx,
+		`INSERT INTO operations (id, kind, status, actor) VALUES ($1, $2, $3, $4)
+		RETURNING created_at, updated_at`,
+		op.Id, op.Kind, op.Status, actor,
+	).Scan(&op.CreatedAt, &op.UpdatedAt)
+	if err != nil {
+		return op, fmt.Errorf("record operation: %w", err)
+	}
+
+	// While the connection is being recovered the command fails like any
+	// other publish and the client gets 503.
+	var confirm *amqp091.DeferredConfirmation
+	ch, err := t.Ch.Get()
+	if err == nil {
+		confirm, err = ch.PublishWithDeferredConfirmWithContext(ctx,
+			contracts.Exchange, // exchange
+			cmd.RoutingKey,     // routing key
+			false,              // mandatory
+			false,              // immediate
+			amqp091.Publishing{
+				ContentType: "text/plain",
+				MessageId:   op.Id,
+				Headers:     headers,
+				Body:        jsonData,
+			})
+	}
+	if err == nil && confirm != nil {
+		// In confirm mode the 202 waits for the broker, so a command is
+		// never acknowledged to the client and then lost on shutdown.
+		var acked bool
+		acked, err = confirm.WaitContext(ctx)
+		if err == nil && !acked {
+			err = errors.New("broker rejected the command")
+		}
+	}
+	if err != nil {
+		if _, uerr := t.Db.ExecContext(ctx,
+			`UPDATE operations SET status = $1, error = $2, updated_at = now() WHERE id = $3`,
+			handler.OperationFailed, "command was not published", op.Id,
+		); uerr != nil {
+			fmt.Println("error in marking operation failed:", uerr)
+		}
+		return op, fmt.Errorf("publish %s: %w", cmd.RoutingKey, err)
+	}
+
+	return op, nil
+}
+
+// accepted answers 202 with a Location pointing at the operation.
+func accepted(c *gin.Context, op handler.Operation) {
+	c.Header("Location", "/lib/operations/"+op.Id)
+	c.JSON(http.StatusAccepted, op)
+}
+
+func (t *Tracer) GetOperation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	op, err := t.loadOperation(ctx, c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		problem(c, http.StatusNotFound, handler.CodeNotFound, "operation "+c.Param("id")+" does not exist")
+		return
+	}
+	if err != nil {
+		unavailable(c, "failed to load operation", err)
+		return
+	}
+	c.JSON(http.StatusOK, op)
+}
+
+func (t *Tracer) loadOperation(ctx context.Context, id string) (handler.Operation, error) {
+	var op handler.Operation
+	var bookId sql.NullInt64
+	var bookIds pq.Int64Array
+	var reason sql.NullString
+	var code sql.NullInt64
+	err := t.Db.QueryRowContext(ctx,
+		`SELECT id, kind, status, book_id, book_ids, error, status_code, created_at, updated_at
+		FROM operations WHERE id = $1`, id,
+	).Scan(&op.Id, &op.Kind, &op.Status, &bookId, &bookIds, &reason, &code, &op.CreatedAt, &op.UpdatedAt)
+	if err != nil {
+		return op, err
+	}
+
+	if bookId.Valid {
+		id := int(bookId.Int64)
+		op.BookId = &id
+	}
+	for _, id := range bookIds {
+		op.BookIds = append(op.BookIds, int(id))
+	}
+	op.Error = reason.String
+	op.StatusCode = int(code.Int64)
+	return op, nil
+}
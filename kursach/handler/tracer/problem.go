@@ -0,0 +1,72 @@
+package tracer
+
+import (
+	"errors"
+	"fmt"
+	"handler"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem aborts the request with an RFC 7807 body.
+func problem(c *gin.Context, status int, code, detail string, fields ...handler.FieldError) {
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(status, handler.Problem{
+		Type:     "/problems/" + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+		Code:     code,
+		Errors:   fields,
+	})
+}
+
+// invalid answers with the given status and the field list of a
+// ValidationError, or with just its text for any other error.
+func invalid(c *gin.Context, status int, code string, err error) {
+	var verr handler.ValidationError
+	if errors.As(err, &verr) {
+		problem(c, status, code, "request has invalid fields", verr...)
+		return
+	}
+	problem(c, status, code, err.Error())
+}
+
+// unavailable logs a dependency failure and answers 503. The cause stays in
+// the log so internals do not leak to clients.
+func unavailable(c *gin.Context, what string, err error) {
+	fmt.Printf("%s: %v\n", what, err)
+	problem(c, http.StatusServiceUnavailable, handler.CodeUnavailable, what)
+}
+
+// bindBook decodes, normalizes and validates a book from the request body.
+func bindBook(c *gin.Context, book *handler.Book) bool {
+	if err := c.ShouldBindJSON(book); err != nil {
+		problem(c, http.StatusBadRequest, handler.CodeInvalidJSON, "request body is not a valid book: "+err.Error())
+		return false
+	}
+	book.Normalize()
+	if err := book.Validate(); err != nil {
+		invalid(c, http.StatusUnprocessableEntity, handler.CodeValidationFailed, err)
+		return false
+	}
+	return true
+}
+
+func NotFound(c *gin.Context) {
+	problem(c, http.StatusNotFound, handler.CodeNotFound, "no route for "+c.Request.Method+" "+c.Request.URL.Path)
+}
+
+func MethodNotAllowed(c *gin.Context) {
+	problem(c, http.StatusMethodNotAllowed, handler.CodeMethodNotAllowed, c.Request.Method+" is not allowed here")
+}
+
+// Recovery turns a panic into a 500 problem instead of a dropped connection.
+func Recovery(c *gin.Context, recovered any) {
+	fmt.Printf("panic in %s %s: %v\n", c.Request.Method, c.Request.URL.Path, recovered)
+	problem(c, http.StatusInternalServerError, handler.CodeInternal, "unexpected server error")
+}
@@ -0,0 +1,134 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"handler"
+	"handler/auth"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimit is a token bucket: Burst requests at once, refilled at
+// PerSecond.
+type RateLimit struct {
+	Burst     int
+	PerSecond float64
+}
+
+var defaultRateLimit = RateLimit{Burst: 100, PerSecond: 20}
+
+// routeRateLimits override the default for the routes that publish to
+// do.direct or stream the whole table.
+var routeRateLimits = map[string]RateLimit{
+	"POST /lib":       {Burst: 20, PerSecond: 5},
+	"PUT /lib":        {Burst: 20, PerSecond: 5},
+	"DELETE /lib":     {Burst: 10, PerSecond: 2},
+	"POST /lib/bulk":  {Burst: 2, PerSecond: 0.1},
+	"GET /lib/export": {Burst: 2, PerSecond: 0.05},
+	"GET /lib/events": {Burst: 5, PerSecond: 0.5},
+	"GET /lib/ws":     {Burst: 5, PerSecond: 0.5},
+	"GET /lib/search": {Burst: 30, PerSecond: 10},
+}
+
+// tokenBucket takes one token from the bucket in KEYS[1] and answers
+// {allowed, remaining, ms until a token is back, ms until the bucket is
+// full}. The clock is Redis's own, so replicas with skewed clocks share
+// one limit.
+var tokenBucket = redis.NewScript(`
+redis.replicate_commands()
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+
+local retry = 0
+if allowed == 0 then
+	retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+local full = math.ceil((burst - tokens) * 1000 / rate)
+return {allowed, math.floor(tokens), retry, full}
+`)
+
+// ipRateLimit caps what one address may send across all routes before it
+// is authenticated, so a flood of bad credentials cannot turn into as many
+// API-key lookups. It is well above any single route's limit.
+var ipRateLimit = RateLimit{Burst: 300, PerSecond: 60}
+
+// RateLimitIP throttles each client address. It runs before Authenticate;
+// RateLimit then applies the per-principal limits. ClientIP only honours
+// X-Forwarded-For from the router's trusted proxies, so callers cannot
+// pick a fresh address per request.
+func (t *Tracer) RateLimitIP(c *gin.Context) {
+	route := c.Request.Method + " " + c.FullPath()
+	t.throttle(c, "ratelimit:ip:"+c.ClientIP(), route, ipRateLimit, "for this address")
+}
+
+// RateLimit throttles each client per route. Clients are told apart by
+// principal, so it runs after Authenticate. When Redis is down requests
+// are let through rather than failing the whole API.
+func (t *Tracer) RateLimit(c *gin.Context) {
+	route := c.Request.Method + " " + c.FullPath()
+	limit, ok := routeRateLimits[route]
+	if !ok {
+		limit = defaultRateLimit
+	}
+
+	client := c.ClientIP()
+	if p, ok := auth.FromContext(c.Request.Context()); ok {
+		client = p.String()
+	}
+	t.throttle(c, "ratelimit:"+route+":"+client, route, limit, "for "+route)
+}
+
+// throttle takes a token from the bucket under key and answers 429 when
+// it is empty.
+func (t *Tracer) throttle(c *gin.Context, key, route string, limit RateLimit, scope string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second)
+	defer cancel()
+	res, err := tokenBucket.Run(ctx, t.Rdb, []string{key},
+		limit.Burst, limit.PerSecond).Int64Slice()
+	if err != nil || len(res) != 4 {
+		fmt.Println("error in rate limit:", err)
+		c.Next()
+		return
+	}
+	allowed, remaining, retry, full := res[0] == 1, res[1], res[2], res[3]
+
+	c.Header("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	c.Header("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	c.Header("RateLimit-Reset", strconv.FormatInt(ceilSeconds(full), 10))
+	if !allowed {
+		t.Metrics.Throttled.WithLabelValues(route).Inc()
+		c.Header("Retry-After", strconv.FormatInt(ceilSeconds(retry), 10))
+		problem(c, http.StatusTooManyRequests, handler.CodeRateLimited,
+			fmt.Sprintf("rate limit of %d requests exceeded %s", limit.Burst, scope))
+		return
+	}
+	c.Next()
+}
+
+func ceilSeconds(ms int64) int64 {
+	return (ms + 999) / 1000
+}
@@ -0,0 +1,118 @@
+package tracer
+
+import (
+	"context"
+	"handler"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Search runs a full-text query over book descriptions. Every word of q is
+// matched as a prefix, results are ordered by ts_rank and come with a
+// highlighted snippet that is safe to render as HTML.
+func (t *Tracer) Search(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		t.Metrics.DBQueryTime.Observe(time.Since(start).Seconds())
+	}()
+
+	tsquery := prefixQuery(c.Query("q"))
+	if tsquery == "" {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter,
+			handler.ValidationError{{Field: "q", Message: "must contain at least one word"}})
+		return
+	}
+
+	limit, offset, err := parseSearchWindow(c)
+	if err != nil {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := t.Db.QueryContext(ctx, `
+	SELECT `+bookColumns+`,
+		ts_rank(search, query) AS rank,
+		ts_headline('simple', translate(description, chr(1) || chr(2), ''), query,
+			'StartSel=' || chr(1) || ', StopSel=' || chr(2) || ', MaxWords=35, MinWords=15, MaxFragments=2')
+	FROM books, to_tsquery('simple', $1) query
+	WHERE search @@ query AND deleted_at IS NULL
+	ORDER BY rank DESC, id
+	LIMIT $2 OFFSET $3`, tsquery, limit, offset)
+	if err != nil {
+		unavailable(c, "search failed", err)
+		return
+	}
+	defer rows.Close()
+
+	hits := []handler.SearchHit{}
+	for rows.Next() {
+		var hit handler.SearchHit
+		var err error
+		hit.Book, err = scanBook(rows, &hit.Rank, &hit.Snippet)
+		if err != nil {
+			unavailable(c, "search failed", err)
+			return
+		}
+		hit.Snippet = highlight(hit.Snippet)
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		unavailable(c, "search failed", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hits)
+}
+
+func parseSearchWindow(c *gin.Context) (int, int, error) {
+	limit, offset := defaultSearchLimit, 0
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return 0, 0, handler.ValidationError{{Field: "limit", Message: "must be a positive integer"}}
+		}
+		limit = min(n, maxSearchLimit)
+	}
+	if s := c.Query("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, 0, handler.ValidationError{{Field: "offset", Message: "must be a non-negative integer"}}
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+// highlight escapes the snippet for HTML and only then turns the markers
+// ts_headline put around matches into <mark> tags, so markup stored in a
+// description is shown as text.
+func highlight(snippet string) string {
+	return strings.NewReplacer("\x01", "<mark>", "\x02", "</mark>").Replace(html.EscapeString(snippet))
+}
+
+// prefixQuery turns free text into a tsquery where every word is a prefix
+// match, e.g. "war pea" becomes "war:* & pea:*". Anything that is not a
+// letter or digit is dropped so user input cannot break the tsquery syntax.
+func prefixQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = strings.ToLower(w) + ":*"
+	}
+	return strings.Join(words, " & ")
+}
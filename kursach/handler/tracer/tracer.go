@@ -2,17 +2,19 @@ package tracer
 
 import (
 	"context"
+	"contracts"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"handler"
+	"handler/auth"
 	"net/http"
+	"platform/broker"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/rabbitmq/amqp091-go"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -23,6 +25,7 @@ type Metrics struct {
 	DBQueryTime  prometheus.Histogram
 	CacheHit     prometheus.Counter
 	CacheMiss    prometheus.Counter
+	Throttled    *prometheus.CounterVec
 }
 
 func NewMetrics() *Metrics {
@@ -52,14 +55,26 @@ func NewMetrics() *Metrics {
 			Name: "cache_misses_total",
 			Help: "Total number of cache misses",
 		}),
+		Throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rate_limited_requests_total",
+			Help: "Total number of requests rejected by the rate limiter",
+		}, []string{"route"}),
 	}
 }
 
 type Tracer struct {
-	Ch      *amqp091.Channel
+	// Ch publishes commands; it is reopened after the broker reconnects.
+	Ch      *broker.Channel
 	Db      *sql.DB
 	Rdb     *redis.Client
 	Metrics *Metrics
+	Hub     *EventHub
+	Auth    *auth.Authenticator
+	// PrincipalKey signs the principal headers of queued commands.
+	PrincipalKey []byte
+	// WSOrigins are the browser origins besides this host that may open
+	// the WebSocket feed.
+	WSOrigins []string
 }
 
 func (t *Tracer) Create(c *gin.Context) {
@@ -70,54 +85,53 @@ func (t *Tracer) Create(c *gin.Context) {
 		t.Metrics.DBQueryTime.Observe(time.Since(start).Seconds())
 	}()
 
-	if err := c.BindJSON(&book); err != nil {
-		fmt.Println(err.Error(), "ne schital")
+	if !bindBook(c, &book) {
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
-	jsonData, err := json.Marshal(book)
+	op, err := t.enqueue(ctx, contracts.CommandCreate, book)
 	if err != nil {
-		fmt.Println("Ошибка при сериализации JSON:", err)
-		return
-	}
-	err = t.Ch.PublishWithContext(ctx,
-		"do.direct",  // exchange
-		"create.key", // routing key
-		false,        // mandatory
-		false,        // immediate
-		amqp091.Publishing{
-			ContentType: "text/plain",
-			Body:        jsonData,
-		})
-	if err != nil {
-		fmt.Println(err.Error(), "err in send message from POST request")
+		unavailable(c, "failed to queue create", err)
+		return
 	}
-	fmt.Printf(" [x] Sent %s", book.Description)
+	fmt.Printf(" [x] Sent %s\n", book.Description)
 	t.Metrics.BooksCreated.Inc()
-	c.JSON(http.StatusOK, "created")
+	accepted(c, op)
 
 }
 
 func (t *Tracer) GetAll(c *gin.Context) {
-	rows, err := t.Db.Query("SELECT * FROM books")
+	start := time.Now()
+	defer func() {
+		t.Metrics.DBQueryTime.Observe(time.Since(start).Seconds())
+	}()
+
+	q, err := parseListQuery(c)
 	if err != nil {
-		fmt.Println("eror in bd injection")
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter, err)
+		return
 	}
-	defer rows.Close()
-	books := []handler.Book{}
-	for rows.Next() {
-		count := handler.Book{}
 
-		err := rows.Scan(&count.Id, &count.Description)
-		if err != nil {
-			fmt.Printf("Ошибка при сканировании строки: %v\n", err)
-		}
-
-		books = append(books, count)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	page, err := t.listBooks(ctx, q)
+	if err != nil {
+		unavailable(c, "failed to list books", err)
+		return
 	}
-	c.JSON(http.StatusOK, books)
-
+	etag := pageETag(page)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", bookCacheControl)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	page.TotalEstimate, err = t.estimateCount(ctx, q.listFilter)
+	if err != nil {
+		fmt.Println("error in count estimate:", err)
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 func (t *Tracer) GetOne(c *gin.Context) {
@@ -127,119 +141,190 @@ func (t *Tracer) GetOne(c *gin.Context) {
 		t.Metrics.DBQueryTime.Observe(time.Since(start).Seconds())
 	}()
 
-	var book1 handler.Book
-	var err error
-	book1.Id, err = strconv.Atoi(c.Param("id"))
-	if err != nil {
-		fmt.Println("not find id in param")
+	id, ok := bookIdParam(c)
+	if !ok {
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
-	sid := strconv.Itoa(book1.Id)
-	val, err := t.Rdb.Get(ctx, sid).Result()
+	entry, err := t.loadEntry(ctx, id)
+	if err == sql.ErrNoRows {
+		problem(c, http.StatusNotFound, handler.CodeNotFound, fmt.Sprintf("book %d does not exist", id))
+		return
+	}
 	if err != nil {
-		fmt.Println("error in  rdb.get", err)
+		unavailable(c, "failed to load book", err)
+		return
 	}
 
-	if err == redis.Nil {
-		t.Metrics.CacheMiss.Inc()
-		fmt.Println("empty in rdb")
-		rows, err := t.Db.Query("SELECT id, description FROM books WHERE id = $1", book1.Id)
-		if err != nil {
-			fmt.Println("eror in bd injection")
-		}
-		defer rows.Close()
-		books := []handler.Book{}
-		for rows.Next() {
-			count := handler.Book{}
+	c.Header("ETag", entry.ETag)
+	if !entry.Modified.IsZero() {
+		c.Header("Last-Modified", entry.Modified.UTC().Format(http.TimeFormat))
+	}
+	c.Header("Cache-Control", bookCacheControl)
+	if notModified(c.Request, entry.ETag, entry.Modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, entry.Book)
+}
 
-			err := rows.Scan(&count.Id, &count.Description)
-			if err != nil {
-				fmt.Printf("Ошибка при сканировании строки: %v\n", err)
-			}
+// bookCacheTTL bounds how long a cached book can be served even if an
+// invalidation is lost.
+const bookCacheTTL = 10 * time.Minute
 
-			books = append(books, count)
-		}
-		fmt.Println("book", books)
-		if len(books) > 0 {
-			t.Rdb.Set(ctx, sid, books[0].Description, 0)
-			c.JSON(http.StatusOK, books)
-		} else {
-			c.JSON(http.StatusOK, "there is no one with that ID")
-		}
-	} else {
+// fillCache stores ARGV[1] under KEYS[1] for ARGV[3] ms unless the key
+// holds a book, a tombstone, or a stale marker (prefix ARGV[4], see
+// contracts.StaleMarker) newer than version ARGV[2].
+var fillCache = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur then
+	local p = ARGV[4]
+	if string.sub(cur, 1, #p) ~= p then
+		return 0
+	end
+	local v = tonumber(string.sub(cur, #p + 1))
+	if not v or tonumber(ARGV[2]) < v then
+		return 0
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`)
+
+// bookEntry is what the cache holds for a book: the book itself and the
+// validators of a conditional GET, so a 304 needs no database query.
+type bookEntry struct {
+	Book     handler.Book `json:"book"`
+	ETag     string       `json:"etag"`
+	Modified time.Time    `json:"modified"`
+}
+
+// loadBook reads a book through the Redis cache and fills the cache on a
+// miss. A missing or deleted book is reported as sql.ErrNoRows.
+func (t *Tracer) loadBook(ctx context.Context, id int) (handler.Book, error) {
+	entry, err := t.loadEntry(ctx, id)
+	return entry.Book, err
+}
+
+func (t *Tracer) loadEntry(ctx context.Context, id int) (bookEntry, error) {
+	var entry bookEntry
+	sid := contracts.CacheKey(id)
+	val, err := t.Rdb.Get(ctx, sid).Bytes()
+	if err != nil && err != redis.Nil {
+		fmt.Println("error in  rdb.get", err)
+	}
+	if err == nil && string(val) == contracts.CacheTombstone {
 		t.Metrics.CacheHit.Inc()
-		book := handler.Book{}
-		book.Id = book1.Id
-		book.Description = val
-		fmt.Println("book")
-		c.JSON(http.StatusOK, book)
+		return entry, sql.ErrNoRows
+	}
+	if _, stale := contracts.ParseStaleMarker(string(val)); err == nil && !stale {
+		if entry, err = decodeEntry(val); err == nil {
+			t.Metrics.CacheHit.Inc()
+			return entry, nil
+		}
+		fmt.Println("error in cached book", sid, err)
+	}
+
+	t.Metrics.CacheMiss.Inc()
+	entry.Book, err = scanBook(t.Db.QueryRowContext(ctx,
+		"SELECT "+bookColumns+", updated_at FROM books WHERE id = $1 AND deleted_at IS NULL", id),
+		&entry.Modified)
+	if err != nil {
+		return entry, err
+	}
+	entry.ETag = bookETag(entry.Book)
 
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = fillCache.Run(ctx, t.Rdb, []string{sid}, data, entry.Book.Version,
+			bookCacheTTL.Milliseconds(), contracts.CacheStalePrefix).Err()
 	}
+	if err != nil {
+		fmt.Println("error in rdb.set", err)
+	}
+	return entry, nil
+}
 
+// decodeEntry reads a cached book.
+func decodeEntry(val []byte) (bookEntry, error) {
+	var entry bookEntry
+	if err := json.Unmarshal(val, &entry); err != nil {
+		return entry, err
+	}
+	if entry.ETag == "" {
+		return entry, fmt.Errorf("cache entry has no etag")
+	}
+	return entry, nil
 }
 
 func (t *Tracer) Delete(c *gin.Context) {
 	var book handler.Book
 
-	if err := c.BindJSON(&book); err != nil {
-		fmt.Println(err.Error(), "cannot read ID")
+	if err := c.ShouldBindJSON(&book); err != nil {
+		problem(c, http.StatusBadRequest, handler.CodeInvalidJSON, "request body is not valid JSON: "+err.Error())
+		return
+	}
+	if book.Id < 1 {
+		invalid(c, http.StatusUnprocessableEntity, handler.CodeValidationFailed,
+			handler.ValidationError{{Field: "id", Message: "book id is required"}})
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	jsonData, err := json.Marshal(book)
-	if err != nil {
-		fmt.Println("Ошибка при сериализации JSON:", err)
-		return
-	}
-	err = t.Ch.PublishWithContext(ctx,
-		"do.direct",  // exchange
-		"delete.key", // routing key
-		false,        // mandatory
-		false,        // immediate
-		amqp091.Publishing{
-			ContentType: "text/plain",
-			Body:        jsonData,
-		})
+	op, err := t.enqueue(ctx, contracts.CommandDelete, book)
 	if err != nil {
-		fmt.Println(err.Error(), "err in send message from DELETE request")
+		unavailable(c, "failed to queue delete", err)
+		return
 	}
 	fmt.Println(" [x] Sent ", book.Id)
 
-	c.JSON(http.StatusOK, "deleted")
+	accepted(c, op)
 }
 
 func (t *Tracer) Update(c *gin.Context) {
 	var book handler.Book
 
-	if err := c.BindJSON(&book); err != nil {
-		fmt.Println(err.Error())
+	if !bindBook(c, &book) {
+		return
+	}
+	if book.Id < 1 {
+		invalid(c, http.StatusUnprocessableEntity, handler.CodeValidationFailed,
+			handler.ValidationError{{Field: "id", Message: "book id is required"}})
+		return
+	}
+	version, err := parseIfMatch(c.GetHeader("If-Match"), book.Id)
+	if err != nil {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter,
+			handler.ValidationError{{Field: "If-Match", Message: err.Error()}})
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if version != 0 {
+		book.Version = version
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	jsonData, err := json.Marshal(book)
-	if err != nil {
-		fmt.Println("Ошибка при сериализации JSON:", err)
-		return
-	}
-	err = t.Ch.PublishWithContext(ctx,
-		"do.direct",  // exchange
-		"update.key", // routing key
-		false,        // mandatory
-		false,        // immediate
-		amqp091.Publishing{
-			ContentType: "text/plain",
-			Body:        jsonData,
-		})
+	op, err := t.enqueue(ctx, contracts.CommandUpdate, book)
 	if err != nil {
-		fmt.Println(err.Error(), "err in send message from PUT request")
+		unavailable(c, "failed to queue update", err)
+		return
 	}
 	fmt.Println(" [x] Sent ", book)
 
-	c.JSON(http.StatusOK, "updated")
+	accepted(c, op)
+}
+
+// bookIdParam reads the :id path parameter and answers 400 when it is not
+// a positive integer.
+func bookIdParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter,
+			handler.ValidationError{{Field: "id", Message: "must be a positive integer"}})
+		return 0, false
+	}
+	return id, true
 }
@@ -0,0 +1,55 @@
+package tracer
+
+import (
+	"context"
+	"contracts"
+	"fmt"
+	"handler"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Trash lists soft-deleted books that the worker has not purged yet. It
+// takes the same filters, sort and cursor as GetAll.
+func (t *Tracer) Trash(c *gin.Context) {
+	q, err := parseListQuery(c)
+	if err != nil {
+		invalid(c, http.StatusBadRequest, handler.CodeInvalidParameter, err)
+		return
+	}
+	q.Deleted = true
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	page, err := t.listBooks(ctx, q)
+	if err != nil {
+		unavailable(c, "failed to list trash", err)
+		return
+	}
+	page.TotalEstimate, err = t.estimateCount(ctx, q.listFilter)
+	if err != nil {
+		fmt.Println("error in count estimate:", err)
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// Restore queues bringing a book back from the trash.
+func (t *Tracer) Restore(c *gin.Context) {
+	id, ok := bookIdParam(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	op, err := t.enqueue(ctx, contracts.CommandRestore, handler.Book{Id: id})
+	if err != nil {
+		unavailable(c, "failed to queue restore", err)
+		return
+	}
+	fmt.Println(" [x] Sent restore", id)
+
+	accepted(c, op)
+}
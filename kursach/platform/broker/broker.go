@@ -0,0 +1,316 @@
+// Package broker keeps a RabbitMQ connection alive. When the connection
+// drops it redials with jittered exponential backoff, runs the topology
+// hooks again and reopens every registered channel, so publishers and
+// consumers carry on after a broker restart without their owners noticing.
+package broker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	backoffBase = 500 * time.Millisecond
+	backoffMax  = 30 * time.Second
+)
+
+var (
+	ErrNotConnected = errors.New("broker: not connected")
+	ErrClosed       = errors.New("broker: connection manager is closed")
+)
+
+// Metrics report the state of every managed connection, labelled by its
+// name. Create them once per process and register them.
+type Metrics struct {
+	Up         *prometheus.GaugeVec
+	Reconnects *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "amqp_connection_up",
+			Help: "Whether the RabbitMQ connection is open (1) or being recovered (0)",
+		}, []string{"name"}),
+		Reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "amqp_reconnects_total",
+			Help: "Total number of times the RabbitMQ connection was lost and redialed",
+		}, []string{"name"}),
+	}
+}
+
+// Conn is a managed connection. Register hooks, channels and consumers
+// before Start; they are all set up again on every reconnect.
+type Conn struct {
+	url     string
+	name    string
+	metrics *Metrics
+
+	hooks    []func(*amqp091.Connection) error
+	channels []*Channel
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.RWMutex
+	conn *amqp091.Connection
+}
+
+// New returns a manager for url. name labels its metrics and log lines;
+// metrics may be nil.
+func New(url, name string, metrics *Metrics) *Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Conn{url: url, name: name, metrics: metrics, ctx: ctx, cancel: cancel}
+}
+
+// OnConnect adds a hook run on every new connection before the channels
+// are opened, typically to declare the topology.
+func (c *Conn) OnConnect(hook func(*amqp091.Connection) error) {
+	c.hooks = append(c.hooks, hook)
+}
+
+// Channel registers a channel that is reopened, and setup run on it again,
+// whenever it or the connection is lost. setup may be nil.
+func (c *Conn) Channel(setup func(*amqp091.Channel) error) *Channel {
+	ch := &Channel{c: c, setup: setup}
+	c.channels = append(c.channels, ch)
+	return ch
+}
+
+// Consume registers a consumer of queue on its own channel. handle gets
+// every delivery; after a recovery the consumer subscribes again.
+func (c *Conn) Consume(queue string, autoAck bool, handle func(amqp091.Delivery)) {
+	c.Channel(func(ch *amqp091.Channel) error {
+		msgs, err := ch.Consume(queue, "", autoAck, false, false, false, nil)
+		if err != nil {
+			return err
+		}
+		go func() {
+			for msg := range msgs {
+				handle(msg)
+			}
+		}()
+		return nil
+	})
+}
+
+// Start dials until the first connection is set up or ctx ends, then
+// keeps the connection alive in the background until Close.
+func (c *Conn) Start(ctx context.Context) error {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	go c.supervise(conn)
+	return nil
+}
+
+// IsClosed reports whether there is no open connection right now, which
+// is what the readiness probe needs.
+func (c *Conn) IsClosed() bool {
+	conn := c.current()
+	return conn == nil || conn.IsClosed()
+}
+
+// Close stops recovering and closes the connection with its channels.
+func (c *Conn) Close() error {
+	c.cancel()
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+	c.setUp(false)
+	if conn == nil || conn.IsClosed() {
+		return nil
+	}
+	return conn.Close()
+}
+
+func (c *Conn) current() *amqp091.Connection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+func (c *Conn) setUp(up bool) {
+	if c.metrics == nil {
+		return
+	}
+	v := 0.0
+	if up {
+		v = 1
+	}
+	c.metrics.Up.WithLabelValues(c.name).Set(v)
+}
+
+// connect dials and sets the connection up, retrying with backoff.
+func (c *Conn) connect(ctx context.Context) (*amqp091.Connection, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := amqp091.Dial(c.url)
+		if err == nil {
+			if err = c.setup(conn); err != nil {
+				conn.Close()
+			}
+		}
+		if err == nil {
+			log.Printf("[%s] Подключились к RabbitMQ", c.name)
+			c.setUp(true)
+			return conn, nil
+		}
+
+		delay := backoff(attempt)
+		log.Printf("[%s] Не удалось подключиться к RabbitMQ: %v, повтор через %s", c.name, err, delay.Round(time.Millisecond))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			if c.ctx.Err() != nil {
+				return nil, ErrClosed
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Conn) setup(conn *amqp091.Connection) error {
+	for _, hook := range c.hooks {
+		if err := hook(conn); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	for _, ch := range c.channels {
+		if err := ch.open(conn); err != nil {
+			c.mu.Lock()
+			c.conn = nil
+			c.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// supervise waits for the connection to drop and recovers it.
+func (c *Conn) supervise(conn *amqp091.Connection) {
+	for {
+		closed := conn.NotifyClose(make(chan *amqp091.Error, 1))
+		select {
+		case err := <-closed:
+			if c.ctx.Err() != nil {
+				return
+			}
+			c.mu.Lock()
+			if c.conn == conn {
+				c.conn = nil
+			}
+			c.mu.Unlock()
+			c.setUp(false)
+			if c.metrics != nil {
+				c.metrics.Reconnects.WithLabelValues(c.name).Inc()
+			}
+			log.Printf("[%s] Соединение с RabbitMQ потеряно: %v", c.name, err)
+
+			next, cerr := c.connect(c.ctx)
+			if cerr != nil {
+				return
+			}
+			conn = next
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// Channel is a managed channel. Get returns the live one.
+type Channel struct {
+	c     *Conn
+	setup func(*amqp091.Channel) error
+
+	mu sync.RWMutex
+	ch *amqp091.Channel
+}
+
+// Get returns the current channel, or ErrNotConnected while it is being
+// recovered.
+func (ch *Channel) Get() (*amqp091.Channel, error) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	if ch.ch == nil || ch.ch.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return ch.ch, nil
+}
+
+func (ch *Channel) open(conn *amqp091.Connection) error {
+	amqpCh, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	if ch.setup != nil {
+		if err := ch.setup(amqpCh); err != nil {
+			amqpCh.Close()
+			return err
+		}
+	}
+	ch.mu.Lock()
+	ch.ch = amqpCh
+	ch.mu.Unlock()
+	go ch.watch(conn, amqpCh)
+	return nil
+}
+
+// watch reopens the channel when the broker closes it on a live
+// connection, e.g. after a channel-level error. If the whole connection
+// went away, the reconnect reopens it instead.
+func (ch *Channel) watch(conn *amqp091.Connection, amqpCh *amqp091.Channel) {
+	err := <-amqpCh.NotifyClose(make(chan *amqp091.Error, 1))
+	ch.mu.Lock()
+	if ch.ch == amqpCh {
+		ch.ch = nil
+	}
+	ch.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-time.After(backoff(attempt)):
+		case <-ch.c.ctx.Done():
+			return
+		}
+		if conn.IsClosed() || ch.c.current() != conn {
+			return
+		}
+		if attempt == 0 {
+			log.Printf("[%s] Канал RabbitMQ закрыт: %v, открываем заново", ch.c.name, err)
+		}
+		if ch.open(conn) == nil {
+			return
+		}
+	}
+}
+
+// backoff is the full-jitter delay before retry number attempt.
+func backoff(attempt int) time.Duration {
+	d := backoffMax
+	if attempt < 16 {
+		d = min(backoffBase<<attempt, backoffMax)
+	}
+	return time.Duration(rand.Int64N(int64(d))) + time.Millisecond
+}
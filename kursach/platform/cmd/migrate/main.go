@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	_ "github.com/lib/pq"
+
+	"platform/config"
+	"platform/migrations"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate up | down [steps] | status")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	// Только секция БД из окружения или CONFIG_FILE: аргументы заняты командой
+	var cfg struct {
+		DB config.Postgres `yaml:"db"`
+	}
+	if err := config.Load(&cfg, nil); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", cfg.DB.DSN())
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	m, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Ошибка при загрузке миграций: %v", err)
+	}
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "up":
+		if err := m.Up(ctx); err != nil {
+			log.Fatalf("migrate up: %v", err)
+		}
+		log.Printf("схема на версии %d", m.Latest())
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				usage()
+			}
+		}
+		if err := m.Down(ctx, steps); err != nil {
+			log.Fatalf("migrate down: %v", err)
+		}
+	case "status":
+		states, err := m.Status(ctx)
+		if err != nil {
+			log.Fatalf("migrate status: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT\tPROBLEM")
+		for _, st := range states {
+			applied, problem := "pending", ""
+			if st.Applied {
+				applied = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if st.Problem != nil {
+				problem = st.Problem.Error()
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", st.Version, st.Name, applied, problem)
+		}
+		w.Flush()
+	default:
+		usage()
+	}
+}
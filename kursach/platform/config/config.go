@@ -0,0 +1,290 @@
+// Package config loads the typed configuration of a service. Each field
+// of the configuration struct is filled from, in increasing precedence,
+// its default tag, a YAML file, the environment and command line flags:
+//
+//	Port int    `yaml:"port" env:"APP_PORT" flag:"port" default:"8080"`
+//	Host string `yaml:"host" env:"DB_HOST" flag:"db-host" required:"true"`
+//	Key  string `yaml:"principal_key" env:"PRINCIPAL_KEY" secret:"true"`
+//
+// A variable NAME may instead be given as NAME_FILE holding the path of a
+// file with the value, which is how container secrets are mounted. The
+// YAML file is named by the -config flag or CONFIG_FILE. Nested structs
+// become nested YAML sections.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validator is implemented by configurations with rules beyond required
+// fields. Load calls it last.
+type Validator interface {
+	Validate() error
+}
+
+// field is one settable leaf of the configuration struct.
+type field struct {
+	path  string
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+// Load fills cfg, a pointer to a struct, and checks it. args are the
+// command line arguments without the program name; a nil args reads no
+// flags. -h returns flag.ErrHelp after printing the usage.
+func Load(cfg any, args []string) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("config: Load needs a pointer to a struct")
+	}
+	fields := collect(v.Elem(), "")
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	file := fs.String("config", "", "YAML config file (or CONFIG_FILE)")
+	flags := map[string]*string{}
+	for _, f := range fields {
+		if name := f.tag.Get("flag"); name != "" {
+			flags[name] = fs.String(name, f.tag.Get("default"), usage(f))
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if def, ok := f.tag.Lookup("default"); ok {
+			if err := set(f.value, def); err != nil {
+				return fmt.Errorf("config: default of %s: %w", f.path, err)
+			}
+		}
+	}
+
+	if *file == "" {
+		*file = os.Getenv("CONFIG_FILE")
+	}
+	if *file != "" {
+		if err := loadFile(cfg, *file); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fields {
+		name := f.tag.Get("env")
+		if name == "" {
+			continue
+		}
+		s, ok, err := lookupEnv(name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := set(f.value, s); err != nil {
+				return fmt.Errorf("config: %s: %w", name, err)
+			}
+		}
+	}
+
+	var ferr error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.tag.Get("flag") == fl.Name && ferr == nil {
+				if err := set(f.value, *flags[fl.Name]); err != nil {
+					ferr = fmt.Errorf("config: -%s: %w", fl.Name, err)
+				}
+			}
+		}
+	})
+	if ferr != nil {
+		return ferr
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if f.tag.Get("required") == "true" && f.value.IsZero() {
+			errs = append(errs, fmt.Errorf("config: %s is required", source(f)))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if val, ok := cfg.(Validator); ok {
+		if err := val.Validate(); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+	return nil
+}
+
+// Redacted prints the effective configuration one field per line, with
+// secrets masked, for the startup log.
+func Redacted(cfg any) string {
+	var b strings.Builder
+	for _, f := range collect(reflect.Indirect(reflect.ValueOf(cfg)), "") {
+		val := format(f.value)
+		if f.tag.Get("secret") == "true" && !f.value.IsZero() {
+			val = "******"
+		}
+		fmt.Fprintf(&b, "%s = %s\n", f.path, val)
+	}
+	return b.String()
+}
+
+func collect(v reflect.Value, prefix string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, collect(v.Field(i), name)...)
+			continue
+		}
+		fields = append(fields, field{path: name, value: v.Field(i), tag: sf.Tag})
+	}
+	return fields
+}
+
+func loadFile(cfg any, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// lookupEnv reads NAME or, when it is unset, the file named by NAME_FILE.
+// An empty variable counts as unset, as compose passes unset ones empty.
+func lookupEnv(name string) (string, bool, error) {
+	if s := os.Getenv(name); s != "" {
+		return s, true, nil
+	}
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("config: %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func format(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// source names where a field can be set, for error messages.
+func source(f field) string {
+	if name := f.tag.Get("env"); name != "" {
+		return name
+	}
+	if name := f.tag.Get("flag"); name != "" {
+		return "-" + name
+	}
+	return f.path
+}
+
+func usage(f field) string {
+	u := f.tag.Get("usage")
+	if name := f.tag.Get("env"); name != "" {
+		if u != "" {
+			u += " "
+		}
+		u += "(" + name + ")"
+	}
+	return u
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Postgres is the database section every service shares.
+type Postgres struct {
+	Host     string `yaml:"host" env:"DB_HOST" flag:"db-host" required:"true"`
+	Port     int    `yaml:"port" env:"DB_PORT" flag:"db-port" default:"5432"`
+	User     string `yaml:"user" env:"DB_USER" default:"postgres" required:"true"`
+	Password string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" env:"DB_NAME" default:"postgres" required:"true"`
+	SSLMode  string `yaml:"sslmode" env:"DB_SSLMODE" default:"disable"`
+}
+
+// DSN is the lib/pq connection string.
+func (p Postgres) DSN() string {
+	parts := []string{
+		"host=" + quote(p.Host),
+		"port=" + strconv.Itoa(p.Port),
+		"user=" + quote(p.User),
+		"dbname=" + quote(p.Name),
+		"sslmode=" + quote(p.SSLMode),
+	}
+	if p.Password != "" {
+		parts = append(parts, "password="+quote(p.Password))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quote escapes a value of a key=value connection string.
+func quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, ` '\`) {
+		return s
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// Redis is the cache section.
+type Redis struct {
+	Host     string `yaml:"host" env:"RD_HOST" flag:"redis-host" required:"true"`
+	Port     int    `yaml:"port" env:"RD_PORT" default:"6379"`
+	Password string `yaml:"password" env:"RD_PASSWORD" secret:"true"`
+	DB       int    `yaml:"db" env:"RD_DB"`
+}
+
+func (r Redis) Addr() string {
+	return net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+}
+
+// RabbitMQ is the broker section.
+type RabbitMQ struct {
+	Host     string `yaml:"host" env:"RB_HOST" flag:"rabbitmq-host" required:"true"`
+	Port     int    `yaml:"port" env:"RB_PORT" default:"5672"`
+	User     string `yaml:"user" env:"RB_USER" default:"guest" required:"true"`
+	Password string `yaml:"password" env:"RB_PASSWORD" default:"guest" secret:"true"`
+	VHost    string `yaml:"vhost" env:"RB_VHOST" default:"/"`
+}
+
+// URL is the AMQP URI to dial.
+func (r RabbitMQ) URL() string {
+	u := url.URL{
+		Scheme: "amqp",
+		User:   url.UserPassword(r.User, r.Password),
+		Host:   net.JoinHostPort(r.Host, strconv.Itoa(r.Port)),
+	}
+	if r.VHost != "" && r.VHost != "/" {
+		u.Path = "/" + r.VHost
+		u.RawPath = "/" + url.PathEscape(r.VHost)
+	}
+	return u.String()
+}
+
+// Redacted is URL without the password, for logs.
+func (r RabbitMQ) Redacted() string {
+	u, err := url.Parse(r.URL())
+	if err != nil {
+		return r.Host
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,196 @@
+// Package health serves the liveness and readiness probes of a service.
+// Readiness runs the registered dependency checks concurrently, each with
+// its own timeout, and caches the report briefly so frequent probes do not
+// load Postgres, Redis or RabbitMQ.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDraining = "draining"
+)
+
+// DefaultTimeout bounds a check added without its own timeout.
+const DefaultTimeout = 2 * time.Second
+
+// Checker reports whether a dependency is usable.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error { return f(ctx) }
+
+// DB pings Postgres.
+func DB(db *sql.DB) Checker {
+	return CheckerFunc(db.PingContext)
+}
+
+// Redis pings Redis.
+func Redis(rdb *redis.Client) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	})
+}
+
+// Connection is a RabbitMQ connection as AMQP sees it. Both
+// *amqp091.Connection and the managed broker.Conn have it.
+type Connection interface {
+	IsClosed() bool
+}
+
+// AMQP checks that the RabbitMQ connection is still open. The client
+// notices a dead broker by its heartbeats, so no round trip is needed.
+func AMQP(conn Connection) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if conn == nil || conn.IsClosed() {
+			return errors.New("connection is closed")
+		}
+		return nil
+	})
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the body of both probes.
+type Report struct {
+	Status    string            `json:"status"`
+	Checks    map[string]Result `json:"checks,omitempty"`
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+type check struct {
+	name    string
+	checker Checker
+	timeout time.Duration
+}
+
+// Health holds the checks of a service. Register them before serving.
+type Health struct {
+	ttl      time.Duration
+	checks   []check
+	draining atomic.Bool
+
+	mu   sync.Mutex
+	last Report
+}
+
+// New returns a Health that reuses a readiness report for ttl.
+func New(ttl time.Duration) *Health {
+	return &Health{ttl: ttl}
+}
+
+// Add registers a dependency check for readiness. A zero timeout means
+// DefaultTimeout.
+func (h *Health) Add(name string, c Checker, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	h.checks = append(h.checks, check{name: name, checker: c, timeout: timeout})
+}
+
+// Drain makes readiness fail from now on, so the load balancer stops
+// sending requests while the service finishes the ones it has.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Check returns the readiness report, running the checks again when the
+// cached one is older than the ttl. Concurrent callers share one run.
+func (h *Health) Check(ctx context.Context) Report {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if time.Since(h.last.CheckedAt) < h.ttl {
+		return h.withDraining(h.last)
+	}
+
+	// The run is shared, so one caller going away must not fail it for
+	// the others; the per-check timeouts bound it instead.
+	ctx = context.WithoutCancel(ctx)
+	results := make([]Result, len(h.checks))
+	var wg sync.WaitGroup
+	for i, c := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: map[string]Result{}, CheckedAt: time.Now()}
+	for i, c := range h.checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	h.last = report
+	return h.withDraining(report)
+}
+
+func (h *Health) withDraining(r Report) Report {
+	if h.draining.Load() {
+		r.Status = StatusDraining
+	}
+	return r
+}
+
+func run(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.checker.Check(ctx)
+	res := Result{Status: StatusUp, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Livez answers whether the process itself works. It does not look at
+// dependencies: restarting the service would not bring Postgres back.
+func (h *Health) Livez(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusUp, CheckedAt: time.Now()})
+}
+
+// Readyz answers 200 when every dependency is up and the service is not
+// draining, and 503 otherwise, with the per-dependency report either way.
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+	code := http.StatusOK
+	if report.Status != StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	writeReport(w, code, report)
+}
+
+func writeReport(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,131 @@
+package migrations
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func file(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+func TestLoadOrdersPairs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_index.up.sql":      file("CREATE INDEX i ON t (a);"),
+		"0002_add_index.down.sql":    file("DROP INDEX i;"),
+		"0001_create_table.up.sql":   file("CREATE TABLE t (a INT);"),
+		"0001_create_table.down.sql": file("DROP TABLE t;"),
+		"README.md":                  file("not a migration"),
+	}
+	list, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("loaded %d migrations, want 2", len(list))
+	}
+	if list[0].Version != 1 || list[0].Name != "create_table" || list[1].Version != 2 || list[1].Name != "add_index" {
+		t.Errorf("got %d_%s, %d_%s", list[0].Version, list[0].Name, list[1].Version, list[1].Name)
+	}
+	if list[0].Up != "CREATE TABLE t (a INT);" || list[0].Down != "DROP TABLE t;" {
+		t.Errorf("up/down not paired: %+v", list[0])
+	}
+	if list[0].Checksum == "" || list[0].Checksum == list[1].Checksum {
+		t.Errorf("checksums not computed per migration: %q, %q", list[0].Checksum, list[1].Checksum)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{"missing down", fstest.MapFS{
+			"0001_a.up.sql": file("SELECT 1;"),
+		}, "needs both up and down"},
+		{"missing up", fstest.MapFS{
+			"0001_a.down.sql": file("SELECT 1;"),
+		}, "needs both up and down"},
+		{"gap", fstest.MapFS{
+			"0001_a.up.sql": file("SELECT 1;"), "0001_a.down.sql": file("SELECT 1;"),
+			"0003_c.up.sql": file("SELECT 3;"), "0003_c.down.sql": file("SELECT 3;"),
+		}, "no gaps"},
+		{"not starting at 1", fstest.MapFS{
+			"0002_b.up.sql": file("SELECT 2;"), "0002_b.down.sql": file("SELECT 2;"),
+		}, "no gaps"},
+		{"two names", fstest.MapFS{
+			"0001_a.up.sql": file("SELECT 1;"), "0001_b.down.sql": file("SELECT 1;"),
+		}, "two names"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecksumCoversBothFiles(t *testing.T) {
+	base := fstest.MapFS{
+		"0001_a.up.sql":   file("CREATE TABLE t (a INT);"),
+		"0001_a.down.sql": file("DROP TABLE t;"),
+	}
+	sum := func(fsys fstest.MapFS) string {
+		t.Helper()
+		list, err := Load(fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list[0].Checksum
+	}
+	orig := sum(base)
+
+	up := fstest.MapFS{"0001_a.up.sql": file("CREATE TABLE t (b INT);"), "0001_a.down.sql": base["0001_a.down.sql"]}
+	down := fstest.MapFS{"0001_a.up.sql": base["0001_a.up.sql"], "0001_a.down.sql": file("DROP TABLE IF EXISTS t;")}
+	if sum(up) == orig || sum(down) == orig {
+		t.Error("editing an up or down file must change the checksum")
+	}
+	if sum(base) != orig {
+		t.Error("checksum is not stable")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	list, err := Load(fstest.MapFS{
+		"0001_a.up.sql": file("SELECT 1;"), "0001_a.down.sql": file("SELECT 1;"),
+		"0002_b.up.sql": file("SELECT 2;"), "0002_b.down.sql": file("SELECT 2;"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Migrator{migrations: list}
+
+	if err := m.verify(map[int64]applied{1: {checksum: list[0].Checksum}}); err != nil {
+		t.Errorf("partly migrated database: %v", err)
+	}
+	if err := m.verify(map[int64]applied{1: {checksum: "edited"}}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("edited migration: got %v, want ErrChecksumMismatch", err)
+	}
+	err = m.verify(map[int64]applied{
+		1: {checksum: list[0].Checksum}, 2: {checksum: list[1].Checksum}, 3: {checksum: "newer build"},
+	})
+	if !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("database ahead of the build: got %v, want ErrUnknownVersion", err)
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	sub, err := fs.Sub(files, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(sub); err != nil {
+		t.Fatalf("embedded migrations: %v", err)
+	}
+}
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS books (
+	id SERIAL PRIMARY KEY,
+	description TEXT NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS books_description_trgm_idx;
+DROP INDEX IF EXISTS books_description_id_idx;
@@ -0,0 +1,5 @@
+-- Индексы для постраничной выдачи и фильтра по подстроке. Btree не вмещает
+-- длинные описания (~2.7KB на строку), поэтому сортируем по первым 256 символам
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS books_description_id_idx ON books ((left(description, 256)), id);
+CREATE INDEX IF NOT EXISTS books_description_trgm_idx ON books USING gin (description gin_trgm_ops);
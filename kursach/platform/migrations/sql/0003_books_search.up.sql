@@ -0,0 +1,4 @@
+-- Полнотекстовый поиск по описанию
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search tsvector
+	GENERATED ALWAYS AS (to_tsvector('simple', description)) STORED;
+CREATE INDEX IF NOT EXISTS books_search_idx ON books USING gin (search);
@@ -0,0 +1,10 @@
+-- Журнал асинхронных операций: воркер отмечает в нём результат команды
+CREATE TABLE IF NOT EXISTS operations (
+	id TEXT PRIMARY KEY,
+	kind TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	book_id INT,
+	error TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
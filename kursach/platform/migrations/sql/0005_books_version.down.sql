@@ -0,0 +1,2 @@
+ALTER TABLE operations DROP COLUMN IF EXISTS status_code;
+ALTER TABLE books DROP COLUMN IF EXISTS version;
@@ -0,0 +1,3 @@
+-- Версия записи для оптимистичных блокировок (ETag / If-Match)
+ALTER TABLE books ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS status_code INT;
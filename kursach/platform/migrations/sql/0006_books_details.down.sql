@@ -0,0 +1,7 @@
+ALTER TABLE books
+	DROP COLUMN IF EXISTS tags,
+	DROP COLUMN IF EXISTS language,
+	DROP COLUMN IF EXISTS year,
+	DROP COLUMN IF EXISTS isbn,
+	DROP COLUMN IF EXISTS authors,
+	DROP COLUMN IF EXISTS title;
@@ -0,0 +1,12 @@
+-- Полная карточка книги: старые записи получают пустые значения
+ALTER TABLE books
+	ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS authors TEXT[] NOT NULL DEFAULT '{}',
+	ADD COLUMN IF NOT EXISTS isbn TEXT,
+	ADD COLUMN IF NOT EXISTS year INT,
+	ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS books_title_id_idx ON books (title, id);
+CREATE INDEX IF NOT EXISTS books_title_trgm_idx ON books USING gin (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS books_isbn_idx ON books (isbn);
+CREATE INDEX IF NOT EXISTS books_tags_idx ON books USING gin (tags);
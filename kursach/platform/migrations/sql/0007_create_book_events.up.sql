@@ -0,0 +1,12 @@
+-- Журнал событий книг: воркер пишет событие в одной транзакции с изменением,
+-- id события служит Last-Event-ID для подписчиков ленты
+CREATE TABLE IF NOT EXISTS book_events (
+	id BIGSERIAL PRIMARY KEY,
+	type TEXT NOT NULL,
+	book_id INT NOT NULL,
+	version INT NOT NULL DEFAULT 0,
+	book JSONB,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS book_events_book_id_idx ON book_events (book_id, id);
@@ -0,0 +1,3 @@
+ALTER TABLE book_events DROP COLUMN IF EXISTS actor;
+ALTER TABLE operations DROP COLUMN IF EXISTS actor;
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,13 @@
+-- API-ключи клиентов: храним только SHA-256 от ключа
+CREATE TABLE IF NOT EXISTS api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	revoked_at TIMESTAMPTZ
+);
+
+-- Кто инициировал команду и изменение
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS actor TEXT;
+ALTER TABLE book_events ADD COLUMN IF NOT EXISTS actor TEXT;
@@ -0,0 +1,2 @@
+-- Роли API-ключей: reader, editor или admin
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{reader}';
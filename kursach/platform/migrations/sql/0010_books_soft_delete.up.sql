@@ -0,0 +1,4 @@
+-- Мягкое удаление: строка помечается deleted_at и удаляется насовсем
+-- фоновой очисткой после срока хранения
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx ON books (deleted_at) WHERE deleted_at IS NOT NULL;
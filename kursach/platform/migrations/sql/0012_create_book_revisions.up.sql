@@ -0,0 +1,10 @@
+-- Ревизии книги: состояние полей на каждой версии, которую выставил
+-- воркер при создании или обновлении
+CREATE TABLE IF NOT EXISTS book_revisions (
+	book_id INT NOT NULL,
+	version INT NOT NULL,
+	book JSONB NOT NULL,
+	actor TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (book_id, version)
+);
@@ -0,0 +1,15 @@
+-- Время последнего изменения книги для Last-Modified. Триггер обновляет
+-- его при любом UPDATE, так что воркеру не нужно помнить об этом
+ALTER TABLE books ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE OR REPLACE FUNCTION books_touch_updated_at() RETURNS trigger AS $$
+BEGIN
+	NEW.updated_at := now();
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS books_touch_updated_at ON books;
+CREATE TRIGGER books_touch_updated_at
+	BEFORE UPDATE ON books
+	FOR EACH ROW EXECUTE FUNCTION books_touch_updated_at();
@@ -0,0 +1 @@
+ALTER TABLE operations DROP COLUMN IF EXISTS book_ids;
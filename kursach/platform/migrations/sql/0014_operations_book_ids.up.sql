@@ -0,0 +1,2 @@
+-- Книги, созданные командой импорта: у операции их может быть много
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS book_ids INT[];
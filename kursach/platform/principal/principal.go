@@ -0,0 +1,125 @@
+// Package principal describes who asked for a change and carries that
+// across the queue. The handler signs the principal headers of every
+// command with a key shared with the worker, so the worker can enforce
+// roles on messages that did not come through the HTTP layer.
+package principal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+)
+
+const (
+	RoleReader = "reader"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// rank orders the roles: every role includes the ones below it.
+var rank = map[string]int{
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+const (
+	headerSubject   = "x-principal"
+	headerKind      = "x-principal-kind"
+	headerRoles     = "x-principal-roles"
+	headerSignature = "x-principal-sig"
+)
+
+var (
+	ErrUnsigned     = errors.New("message has no principal signature")
+	ErrBadSignature = errors.New("principal signature does not match")
+)
+
+type Principal struct {
+	Subject string   `json:"sub"`
+	Kind    string   `json:"kind"`
+	Roles   []string `json:"roles,omitempty"`
+}
+
+// String is how the principal is recorded as the actor of a change.
+func (p Principal) String() string {
+	if p.Subject == "" {
+		return ""
+	}
+	return p.Kind + ":" + p.Subject
+}
+
+// Has reports whether p holds role or a role above it.
+func (p Principal) Has(role string) bool {
+	need := rank[role]
+	for _, r := range p.Roles {
+		if rank[r] >= need && need > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// KnownRoles drops role names this package does not know.
+func KnownRoles(roles []string) []string {
+	var known []string
+	for _, r := range roles {
+		if _, ok := rank[r]; ok && !slices.Contains(known, r) {
+			known = append(known, r)
+		}
+	}
+	return known
+}
+
+// Headers returns the message headers for p. The signature covers the
+// message id and body too, so it cannot be moved to another command.
+func (p Principal) Headers(key []byte, messageId string, body []byte) map[string]any {
+	roles := strings.Join(p.Roles, ",")
+	h := map[string]any{
+		headerSubject: p.Subject,
+		headerKind:    p.Kind,
+		headerRoles:   roles,
+	}
+	if len(key) > 0 {
+		h[headerSignature] = sign(key, messageId, body, p.Subject, p.Kind, roles)
+	}
+	return h
+}
+
+// FromHeaders reads the principal of a message and checks its signature.
+// The principal is returned even when the check fails, for logging only.
+func FromHeaders(key []byte, messageId string, body []byte, headers map[string]any) (Principal, error) {
+	sub, _ := headers[headerSubject].(string)
+	kind, _ := headers[headerKind].(string)
+	roles, _ := headers[headerRoles].(string)
+	sig, _ := headers[headerSignature].(string)
+
+	p := Principal{Subject: sub, Kind: kind}
+	if roles != "" {
+		p.Roles = strings.Split(roles, ",")
+	}
+	if sig == "" || len(key) == 0 {
+		return p, ErrUnsigned
+	}
+	want := sign(key, messageId, body, sub, kind, roles)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return p, ErrBadSignature
+	}
+	return p, nil
+}
+
+func sign(key []byte, messageId string, body []byte, fields ...string) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(messageId))
+	for _, f := range fields {
+		mac.Write([]byte{0})
+		mac.Write([]byte(f))
+	}
+	mac.Write([]byte{0})
+	mac.Write(sum[:])
+	return hex.EncodeToString(mac.Sum(nil))
+}
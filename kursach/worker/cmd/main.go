@@ -1,57 +1,97 @@
 package main
 
 import (
+	"context"
+	"contracts"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"platform/broker"
+	"platform/config"
+	"platform/health"
+	"platform/migrations"
+	"platform/principal"
+	"sort"
+	"strconv"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
 )
 
-// Book структура для работы с таблицей books
-type Book struct {
-	ID          int    `json:"id"`
-	Description string `json:"description"`
+// Book и BookEvent общие с handler, см. модуль contracts
+type (
+	Book      = contracts.Book
+	BookEvent = contracts.BookEvent
+)
+
+// commandError - ошибка команды с HTTP-статусом, который увидит клиент
+// в результате операции
+type commandError struct {
+	code int
+	msg  string
 }
 
-var db *sql.DB
+func (e *commandError) Error() string { return e.msg }
+
+func cmdError(code int, format string, args ...any) error {
+	return &commandError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// Config воркера; источники и их порядок описаны в platform/config
+type Config struct {
+	Port        int             `yaml:"port" env:"APP_PORT" flag:"port" default:"8081"`
+	MetricsPort int             `yaml:"metrics_port" env:"METRICS_PORT" flag:"metrics-port" default:"9100"`
+	DB          config.Postgres `yaml:"db"`
+	Redis       config.Redis    `yaml:"redis"`
+	RabbitMQ    config.RabbitMQ `yaml:"rabbitmq"`
+	// PrincipalKey проверяет подпись автора команд
+	PrincipalKey string `yaml:"principal_key" env:"PRINCIPAL_KEY" secret:"true"`
+	// BookRetention - сколько удалённая книга лежит в корзине
+	BookRetention time.Duration `yaml:"book_retention" env:"BOOK_RETENTION" default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env:"PURGE_INTERVAL" default:"1h"`
+}
+
+func (c *Config) Validate() error {
+	if c.BookRetention <= 0 || c.PurgeInterval <= 0 {
+		return fmt.Errorf("неверные длительности очистки корзины: %s, %s", c.BookRetention, c.PurgeInterval)
+	}
+	return nil
+}
+
+var (
+	db     *sql.DB
+	rdb    *redis.Client
+	events *broker.Channel
+	// principalKey проверяет подпись заголовков с автором команды
+	principalKey []byte
+)
 
 func main() {
-	var conn *amqp091.Connection
 	var err error
 
-	// Подключение к RabbitMQ
-	for i := 0; i < 10; i++ {
-		rabbit := os.Getenv("RB_HOST")
-		s := fmt.Sprint("amqp://guest:guest@", rabbit, ":5672")
-		fmt.Println("Подключаюсь к RabbitMQ: ", s)
-		conn, err = amqp091.Dial(s)
-		if err != nil {
-			fmt.Println(err, "Failed to connect to RabbitMQ")
-		} else {
-			fmt.Println("Успешное подключение к RabbitMQ")
-			break
-		}
-		time.Sleep(3 * time.Second)
+	var cfg Config
+	if err := config.Load(&cfg, os.Args[1:]); err != nil {
+		log.Printf("Ошибка в конфигурации: %v", err)
+		os.Exit(2)
 	}
-	defer conn.Close()
+	fmt.Print("Конфигурация:\n", config.Redacted(&cfg))
 
-	// Подключение к PostgreSQL
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_NAME")
-
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+	principalKey = []byte(cfg.PrincipalKey)
+	if len(principalKey) == 0 {
+		log.Println("PRINCIPAL_KEY не задан: команды на удаление будут отклонены")
+	}
 
-	db, err = sql.Open("postgres", dsn)
-	fmt.Println("Подключаюсь к PostgreSQL: ", dsn)
+	// Подключение к PostgreSQL
+	db, err = sql.Open("postgres", cfg.DB.DSN())
+	fmt.Println("Подключаюсь к PostgreSQL: ", cfg.DB.Host)
 	if err != nil {
 		log.Fatalf("Error connecting to database: %v\n", err)
 	} else {
@@ -65,150 +105,739 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Схема БД: применяем миграции под advisory lock вместе с handler
+	// и отказываемся работать с неизвестной версией схемы
+	migrator, err := migrations.New(db)
+	failOnError(err, "Ошибка при загрузке миграций")
+	err = migrator.Up(context.Background())
+	failOnError(err, "Ошибка при миграции схемы")
+	err = migrator.Check(context.Background())
+	failOnError(err, "Схема БД не совпадает с ожидаемой")
+
+	// Подключение к Redis: воркер сбрасывает кэш изменённых книг
+	rdb = redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr(),
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	defer rdb.Close()
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		log.Printf("Не удалось подключиться к Redis: %v", err)
+	}
+
+	// Подключение к RabbitMQ: после обрыва broker переподключается,
+	// заново объявляет топологию и подписывается на очереди
+	brokerMetrics := broker.NewMetrics()
+	fmt.Println("Подключаюсь к RabbitMQ: ", cfg.RabbitMQ.Redacted())
+	mq := broker.New(cfg.RabbitMQ.URL(), "worker", brokerMetrics)
+	defer mq.Close()
+	mq.OnConnect(declareTopology)
+
+	// Отдельный канал для публикации событий книг
+	events = mq.Channel(nil)
+
+	// По очереди на каждую команду, имена и ключи общие с handler
+	handlers := map[string]commandHandler{
+		contracts.CommandCreate.Kind:  single(handleCreate),
+		contracts.CommandUpdate.Kind:  single(handleUpdate),
+		contracts.CommandDelete.Kind:  single(handleDelete),
+		contracts.CommandRestore.Kind: single(handleRestore),
+		contracts.CommandBulk.Kind:    handleBulk,
+	}
+	for _, cmd := range contracts.Commands {
+		mq.Consume(cmd.Queue, true, listenQueue(cmd.Queue, handlers[cmd.Kind]))
+	}
+	err = mq.Start(context.Background())
+	failOnError(err, "Failed to connect to RabbitMQ")
+
+	// Фоновая очистка корзины
+	go purgeTrash(cfg.BookRetention, cfg.PurgeInterval)
+	log.Printf("Книги хранятся в корзине %s", cfg.BookRetention)
+
+	// Пробы живости и готовности для оркестратора
+	probes := health.New(time.Second)
+	probes.Add("postgres", health.DB(db), 0)
+	probes.Add("redis", health.Redis(rdb), 0)
+	probes.Add("rabbitmq", health.AMQP(mq), 0)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(brokerMetrics.Up, brokerMetrics.Reconnects)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /livez", probes.Livez)
+	mux.HandleFunc("GET /readyz", probes.Readyz)
+	go func() {
+		log.Printf("Пробы доступны на :%d", cfg.Port)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), mux); err != nil {
+			log.Printf("Ошибка сервера проб: %v", err)
+		}
+	}()
+
+	// Метрики на отдельном внутреннем порту, как у handler
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func() {
+		log.Printf("Метрики доступны на :%d", cfg.MetricsPort)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.MetricsPort), metricsMux); err != nil {
+			log.Printf("Ошибка сервера метрик: %v", err)
+		}
+	}()
+
+	log.Println(" [*] Слушаем очереди. Нажмите CTRL+C для выхода.")
+	select {} // Блокируем основной поток
+}
+
+// declareTopology объявляет exchange и очереди команд. broker вызывает её
+// при каждом подключении, так что после рестарта RabbitMQ всё на месте
+func declareTopology(conn *amqp091.Connection) error {
 	ch, err := conn.Channel()
-	failOnError(err, "Failed to open a channel")
+	if err != nil {
+		return err
+	}
 	defer ch.Close()
 
 	err = ch.ExchangeDeclare(
-		"do.direct", // имя exchange
-		"direct",    // тип
+		contracts.Exchange, // имя exchange
+		"direct",           // тип
 		true, false, false, false, nil,
 	)
-	failOnError(err, "Failed to declare exchange")
-
-	// Очередь для создания
-	q1, err := ch.QueueDeclare("queue.create", true, false, false, false, nil)
-	failOnError(err, "Failed to declare queue")
-	err = ch.QueueBind(q1.Name, "create.key", "do.direct", false, nil)
-	failOnError(err, "Failed to bind queue")
-	fmt.Println("Создали очередь create")
-
-	// Очередь для обновления
-	q2, err := ch.QueueDeclare("queue.update", true, false, false, false, nil)
-	failOnError(err, "Failed to declare queue")
-	err = ch.QueueBind(q2.Name, "update.key", "do.direct", false, nil)
-	failOnError(err, "Failed to bind queue")
-	fmt.Println("Создали очередь update")
-
-	// Очередь для удаления
-	q3, err := ch.QueueDeclare("queue.delete", true, false, false, false, nil)
-	failOnError(err, "Failed to declare queue")
-	err = ch.QueueBind(q3.Name, "delete.key", "do.direct", false, nil)
-	failOnError(err, "Failed to bind queue")
-	fmt.Println("Создали очередь delete")
-
-	// Запускаем обработчики для 3 очередей
-	go listenQueue(ch, "queue.create", handleCreate)
-	go listenQueue(ch, "queue.update", handleUpdate)
-	go listenQueue(ch, "queue.delete", handleDelete)
+	if err != nil {
+		return fmt.Errorf("объявление exchange: %w", err)
+	}
+	err = ch.ExchangeDeclare(contracts.EventsExchange, "fanout", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("объявление exchange событий: %w", err)
+	}
+	for _, cmd := range contracts.Commands {
+		q, err := ch.QueueDeclare(cmd.Queue, true, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("объявление очереди %s: %w", cmd.Queue, err)
+		}
+		if err := ch.QueueBind(q.Name, cmd.RoutingKey, contracts.Exchange, false, nil); err != nil {
+			return fmt.Errorf("привязка очереди %s: %w", cmd.Queue, err)
+		}
+		fmt.Println("Создали очередь", cmd.Kind)
+	}
+	return nil
+}
 
-	log.Println(" [*] Слушаем очереди. Нажмите CTRL+C для выхода.")
-	select {} // Блокируем основной поток
+// listenQueue возвращает обработчик сообщений очереди queueName
+func listenQueue(queueName string, handler commandHandler) func(amqp091.Delivery) {
+	return func(msg amqp091.Delivery) {
+		// Без верной подписи автор неизвестен и прав у него нет
+		by, err := principal.FromHeaders(principalKey, msg.MessageId, msg.Body, msg.Headers)
+		if err != nil {
+			log.Printf("[→ %s] Не удалось проверить автора %q: %v", queueName, by, err)
+			by = principal.Principal{}
+		}
+		log.Printf("[→ %s] Сообщение от %s: %s", queueName, by, msg.Body)
+		out, err := handler(msg.Body, by, msg.MessageId)
+		recordOutcome(msg.MessageId, out, err)
+	}
 }
 
-func listenQueue(ch *amqp091.Channel, queueName string, handler func([]byte)) {
-	msgs, err := ch.Consume(
-		queueName, "", true, false, false, false, nil,
-	)
-	failOnError(err, "Не удалось подписаться на "+queueName)
+// outcome - книги, которых коснулась команда: одна или пакет импорта
+type outcome struct {
+	bookID  int
+	bookIDs []int
+}
+
+// commandHandler применяет команду и сообщает, каких книг она коснулась
+type commandHandler func(body []byte, by principal.Principal, msgID string) (outcome, error)
 
-	for msg := range msgs {
-		log.Printf("[→ %s] Сообщение: %s", queueName, msg.Body)
-		handler(msg.Body)
+// single приспосабливает обработчик команды над одной книгой
+func single(handle func([]byte, principal.Principal, string) (int, error)) commandHandler {
+	return func(body []byte, by principal.Principal, msgID string) (outcome, error) {
+		id, err := handle(body, by, msgID)
+		return outcome{bookID: id}, err
 	}
 }
 
-func handleCreate(body []byte) {
-	var book Book
-	err := json.Unmarshal(body, &book)
+// recordOutcome отмечает результат команды в таблице operations,
+// чтобы клиент мог узнать его по идентификатору операции. Одну книгу
+// пишем в book_id, пакет импорта - в book_ids
+func recordOutcome(opID string, out outcome, cmdErr error) {
+	if opID == "" {
+		return
+	}
+
+	status, reason, code := contracts.OperationSucceeded, sql.NullString{}, http.StatusOK
+	if cmdErr != nil {
+		status = contracts.OperationFailed
+		reason = sql.NullString{String: cmdErr.Error(), Valid: true}
+		code = http.StatusInternalServerError
+		var ce *commandError
+		if errors.As(cmdErr, &ce) {
+			code = ce.code
+		}
+	}
+	id := sql.NullInt64{Int64: int64(out.bookID), Valid: out.bookID != 0}
+	ids := pq.Array(out.bookIDs)
+
+	_, err := db.Exec(`
+	UPDATE operations
+	SET status = $1, book_id = $2, book_ids = $3, error = $4, status_code = $5, updated_at = now()
+	WHERE id = $6`, status, id, ids, reason, code, opID)
+	if err != nil {
+		log.Printf("[OPERATION] Ошибка при сохранении результата %s: %v", opID, err)
+	}
+}
+
+func handleCreate(body []byte, by principal.Principal, msgID string) (int, error) {
+	book, err := contracts.Decode[Book](body)
 	if err != nil {
 		log.Printf("[CREATE] Ошибка парсинга JSON: %v", err)
-		return
+		return 0, cmdError(http.StatusBadRequest, "invalid message: %v", err)
 	}
 
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[CREATE] Ошибка при открытии транзакции: %v", err)
+		return 0, errors.New("failed to insert book")
+	}
+	defer tx.Rollback()
+
 	sqlStatement := `
-	INSERT INTO books (description)
-	VALUES ($1)
-	RETURNING id`
+	INSERT INTO books (title, authors, isbn, year, language, tags, description)
+	VALUES ($1, COALESCE($2::text[], '{}'), NULLIF($3, ''), NULLIF($4, 0), $5, COALESCE($6::text[], '{}'), $7)
+	RETURNING id, version`
 
-	var id int
-	err = db.QueryRow(sqlStatement, book.Description).Scan(&id)
+	err = tx.QueryRow(sqlStatement, book.Title, pq.Array(book.Authors), book.ISBN, book.Year,
+		book.Language, pq.Array(book.Tags), book.Description).Scan(&book.Id, &book.Version)
 	if err != nil {
 		log.Printf("[CREATE] Ошибка при создании записи: %v", err)
-		return
+		return 0, errors.New("failed to insert book")
 	}
 
-	log.Printf("[CREATE] Создана новая запись с ID: %d", id)
+	if err := recordAudit(tx, "create", book.Id, by, msgID, nil, book); err != nil {
+		log.Printf("[CREATE] Ошибка при записи аудита: %v", err)
+		return 0, errors.New("failed to insert book")
+	}
+	if err := recordRevision(tx, book, by); err != nil {
+		log.Printf("[CREATE] Ошибка при записи ревизии: %v", err)
+		return 0, errors.New("failed to insert book")
+	}
+	ev := BookEvent{Type: contracts.EventBookCreated, BookId: book.Id, Version: book.Version, Book: &book, Actor: by.String()}
+	if err := recordEvent(tx, &ev); err != nil {
+		log.Printf("[CREATE] Ошибка при записи события: %v", err)
+		return 0, errors.New("failed to insert book")
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[CREATE] Ошибка при фиксации транзакции: %v", err)
+		return 0, errors.New("failed to insert book")
+	}
+	publishEvent(ev)
+
+	log.Printf("[CREATE] Создана новая запись с ID: %d", book.Id)
+	return book.Id, nil
 }
 
-func handleUpdate(body []byte) {
-	var book Book
-	err := json.Unmarshal(body, &book)
+func handleUpdate(body []byte, by principal.Principal, msgID string) (int, error) {
+	book, err := contracts.Decode[Book](body)
 	if err != nil {
 		log.Printf("[UPDATE] Ошибка парсинга JSON: %v", err)
-		return
+		return 0, cmdError(http.StatusBadRequest, "invalid message: %v", err)
 	}
 
-	if book.ID == 0 {
+	if book.Id == 0 {
 		log.Printf("[UPDATE] Для обновления необходимо указать ID книги")
-		return
+		return 0, cmdError(http.StatusBadRequest, "book id is required")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[UPDATE] Ошибка при открытии транзакции: %v", err)
+		return book.Id, errors.New("failed to update book")
+	}
+	defer tx.Rollback()
+
+	before, err := lockBook(tx, book.Id)
+	if err == sql.ErrNoRows {
+		log.Printf("[UPDATE] Запись с ID %d не найдена", book.Id)
+		return book.Id, cmdError(http.StatusNotFound, "book %d not found", book.Id)
+	}
+	if err != nil {
+		log.Printf("[UPDATE] Ошибка при чтении записи: %v", err)
+		return book.Id, errors.New("failed to update book")
+	}
+
+	// Версия 0 - безусловное обновление, иначе сверяем с текущей версией
+	if book.Version != 0 && book.Version != before.Version {
+		log.Printf("[UPDATE] Конфликт версий для ID %d: ожидали %d, в базе %d", book.Id, book.Version, before.Version)
+		return book.Id, cmdError(http.StatusPreconditionFailed,
+			"book %d is at version %d, update expected version %d", book.Id, before.Version, book.Version)
 	}
 
 	sqlStatement := `
 	UPDATE books 
-	SET description = $1 
-	WHERE id = $2`
+	SET title = $1, authors = COALESCE($2::text[], '{}'), isbn = NULLIF($3, ''), year = NULLIF($4, 0),
+		language = $5, tags = COALESCE($6::text[], '{}'), description = $7, version = version + 1
+	WHERE id = $8
+	RETURNING version`
 
-	res, err := db.Exec(sqlStatement, book.Description, book.ID)
+	err = tx.QueryRow(sqlStatement, book.Title, pq.Array(book.Authors), book.ISBN, book.Year,
+		book.Language, pq.Array(book.Tags), book.Description, book.Id).Scan(&book.Version)
 	if err != nil {
 		log.Printf("[UPDATE] Ошибка при обновлении записи: %v", err)
-		return
+		return book.Id, errors.New("failed to update book")
 	}
 
-	count, err := res.RowsAffected()
-	if err != nil {
-		log.Printf("[UPDATE] Ошибка при проверке обновленных строк: %v", err)
-		return
+	if err := recordAudit(tx, "update", book.Id, by, msgID, before, book); err != nil {
+		log.Printf("[UPDATE] Ошибка при записи аудита: %v", err)
+		return book.Id, errors.New("failed to update book")
 	}
-
-	if count == 0 {
-		log.Printf("[UPDATE] Запись с ID %d не найдена", book.ID)
-	} else {
-		log.Printf("[UPDATE] Успешно обновлена запись с ID %d", book.ID)
+	// У книг, созданных до появления истории, сначала сохраняем исходное состояние
+	if err := recordRevision(tx, before, principal.Principal{}); err != nil {
+		log.Printf("[UPDATE] Ошибка при записи ревизии: %v", err)
+		return book.Id, errors.New("failed to update book")
 	}
+	if err := recordRevision(tx, book, by); err != nil {
+		log.Printf("[UPDATE] Ошибка при записи ревизии: %v", err)
+		return book.Id, errors.New("failed to update book")
+	}
+	ev := BookEvent{Type: contracts.EventBookUpdated, BookId: book.Id, Version: book.Version, Book: &book, Actor: by.String()}
+	if err := recordEvent(tx, &ev); err != nil {
+		log.Printf("[UPDATE] Ошибка при записи события: %v", err)
+		return book.Id, errors.New("failed to update book")
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[UPDATE] Ошибка при фиксации транзакции: %v", err)
+		return book.Id, errors.New("failed to update book")
+	}
+	invalidateCache(book.Id, book.Version)
+	publishEvent(ev)
+	log.Printf("[UPDATE] Успешно обновлена запись с ID %d", book.Id)
+	return book.Id, nil
 }
 
-func handleDelete(body []byte) {
-	var book Book
-	err := json.Unmarshal(body, &book)
+func handleDelete(body []byte, by principal.Principal, msgID string) (int, error) {
+	book, err := contracts.Decode[Book](body)
 
 	if err != nil {
 		log.Printf("[DELETE] Ошибка парсинга JSON: %v", err)
-		return
+		return 0, cmdError(http.StatusBadRequest, "invalid message: %v", err)
 	}
 
-	if book.ID == 0 {
+	if book.Id == 0 {
 		log.Printf("[DELETE] Для удаления необходимо указать ID книги")
-		return
+		return 0, cmdError(http.StatusBadRequest, "book id is required")
 	}
 
-	sqlStatement := `DELETE FROM books WHERE id = $1`
-	res, err := db.Exec(sqlStatement, book.ID)
+	// Повторная проверка роли: поддельное сообщение в queue.delete не пройдёт
+	if !by.Has(principal.RoleAdmin) {
+		log.Printf("[DELETE] Отказано %q: нужна роль admin", by)
+		return book.Id, cmdError(http.StatusForbidden, "deleting books needs the admin role")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[DELETE] Ошибка при открытии транзакции: %v", err)
+		return book.Id, errors.New("failed to delete book")
+	}
+	defer tx.Rollback()
+
+	before, err := lockBook(tx, book.Id)
+	if err == sql.ErrNoRows {
+		log.Printf("[DELETE] Запись с ID %d не найдена", book.Id)
+		return book.Id, cmdError(http.StatusNotFound, "book %d not found", book.Id)
+	}
+	if err != nil {
+		log.Printf("[DELETE] Ошибка при чтении записи: %v", err)
+		return book.Id, errors.New("failed to delete book")
+	}
+
+	// Мягкое удаление: строку насовсем удалит purgeTrash после срока хранения
+	sqlStatement := `
+	UPDATE books SET deleted_at = now(), version = version + 1
+	WHERE id = $1
+	RETURNING version`
+	err = tx.QueryRow(sqlStatement, book.Id).Scan(&book.Version)
 	if err != nil {
 		log.Printf("[DELETE] Ошибка при удалении записи: %v", err)
-		return
+		return book.Id, errors.New("failed to delete book")
+	}
+
+	if err := recordAudit(tx, "delete", book.Id, by, msgID, before, nil); err != nil {
+		log.Printf("[DELETE] Ошибка при записи аудита: %v", err)
+		return book.Id, errors.New("failed to delete book")
 	}
 
-	count, err := res.RowsAffected()
+	ev := BookEvent{Type: contracts.EventBookDeleted, BookId: book.Id, Version: book.Version, Actor: by.String()}
+	if err := recordEvent(tx, &ev); err != nil {
+		log.Printf("[DELETE] Ошибка при записи события: %v", err)
+		return book.Id, errors.New("failed to delete book")
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[DELETE] Ошибка при фиксации транзакции: %v", err)
+		return book.Id, errors.New("failed to delete book")
+	}
+	tombstoneCache(book.Id)
+	publishEvent(ev)
+	log.Printf("[DELETE] Запись с ID %d перемещена в корзину", book.Id)
+	return book.Id, nil
+}
+
+// handleRestore возвращает книгу из корзины
+func handleRestore(body []byte, by principal.Principal, msgID string) (int, error) {
+	book, err := contracts.Decode[Book](body)
+	if err != nil {
+		log.Printf("[RESTORE] Ошибка парсинга JSON: %v", err)
+		return 0, cmdError(http.StatusBadRequest, "invalid message: %v", err)
+	}
+	if book.Id == 0 {
+		log.Printf("[RESTORE] Для восстановления необходимо указать ID книги")
+		return 0, cmdError(http.StatusBadRequest, "book id is required")
+	}
+	if !by.Has(principal.RoleAdmin) {
+		log.Printf("[RESTORE] Отказано %q: нужна роль admin", by)
+		return book.Id, cmdError(http.StatusForbidden, "restoring books needs the admin role")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[RESTORE] Ошибка при открытии транзакции: %v", err)
+		return book.Id, errors.New("failed to restore book")
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+	UPDATE books SET deleted_at = NULL, version = version + 1
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	RETURNING title, authors, COALESCE(isbn, ''), COALESCE(year, 0), language, tags, description, version`,
+		book.Id).Scan(&book.Title, pq.Array(&book.Authors), &book.ISBN, &book.Year,
+		&book.Language, pq.Array(&book.Tags), &book.Description, &book.Version)
+	if err == sql.ErrNoRows {
+		log.Printf("[RESTORE] Запись с ID %d не найдена в корзине", book.Id)
+		return book.Id, cmdError(http.StatusNotFound, "book %d is not in the trash", book.Id)
+	}
+	if err != nil {
+		log.Printf("[RESTORE] Ошибка при восстановлении записи: %v", err)
+		return book.Id, errors.New("failed to restore book")
+	}
+
+	if err := recordAudit(tx, "restore", book.Id, by, msgID, nil, book); err != nil {
+		log.Printf("[RESTORE] Ошибка при записи аудита: %v", err)
+		return book.Id, errors.New("failed to restore book")
+	}
+	ev := BookEvent{Type: contracts.EventBookRestored, BookId: book.Id, Version: book.Version, Book: &book, Actor: by.String()}
+	if err := recordEvent(tx, &ev); err != nil {
+		log.Printf("[RESTORE] Ошибка при записи события: %v", err)
+		return book.Id, errors.New("failed to restore book")
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[RESTORE] Ошибка при фиксации транзакции: %v", err)
+		return book.Id, errors.New("failed to restore book")
+	}
+	invalidateCache(book.Id, book.Version)
+	publishEvent(ev)
+	log.Printf("[RESTORE] Запись с ID %d восстановлена", book.Id)
+	return book.Id, nil
+}
+
+// purgeTrash раз в interval удаляет насовсем книги, пролежавшие в корзине
+// дольше retention. Удаляем пачками, чтобы не держать долгих блокировок
+func purgeTrash(retention, interval time.Duration) {
+	for {
+		total := 0
+		for {
+			res, err := db.Exec(`
+			DELETE FROM books WHERE id IN (
+				SELECT id FROM books
+				WHERE deleted_at IS NOT NULL AND deleted_at < now() - $1::interval
+				LIMIT 1000)`, fmt.Sprintf("%d seconds", int64(retention.Seconds())))
+			if err != nil {
+				log.Printf("[PURGE] Ошибка при очистке корзины: %v", err)
+				break
+			}
+			n, _ := res.RowsAffected()
+			total += int(n)
+			if n < 1000 {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("[PURGE] Удалено из корзины навсегда: %d", total)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// handleBulk вставляет пакет книг одним INSERT в транзакции, поэтому пакет
+// применяется целиком или не применяется вовсе. Каждая книга получает свою
+// запись аудита, ревизию и событие, как при обычном создании
+func handleBulk(body []byte, by principal.Principal, msgID string) (outcome, error) {
+	books, err := contracts.Decode[contracts.BulkImport](body)
 	if err != nil {
-		log.Printf("[DELETE] Ошибка при проверке удаленных строк: %v", err)
+		log.Printf("[BULK] Ошибка парсинга JSON: %v", err)
+		return outcome{}, cmdError(http.StatusBadRequest, "invalid message: %v", err)
+	}
+
+	// Импорт - это пакет созданий, поэтому нужна та же роль, что и для POST /lib
+	if !by.Has(principal.RoleEditor) {
+		log.Printf("[BULK] Отказано %q: нужна роль editor", by)
+		return outcome{}, cmdError(http.StatusForbidden, "importing books needs the editor role")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[BULK] Ошибка при открытии транзакции: %v", err)
+		return outcome{}, errors.New("failed to import books")
+	}
+	defer tx.Rollback()
+
+	for i := range books {
+		books[i].Authors = nonNil(books[i].Authors)
+		books[i].Tags = nonNil(books[i].Tags)
+	}
+	data, err := json.Marshal(books)
+	if err != nil {
+		log.Printf("[BULK] Ошибка сериализации пакета: %v", err)
+		return outcome{}, errors.New("failed to import books")
+	}
+
+	rows, err := tx.Query(`
+	INSERT INTO books (title, authors, isbn, year, language, tags, description)
+	SELECT b.title, b.authors, NULLIF(b.isbn, ''), NULLIF(b.year, 0), COALESCE(b.language, ''), b.tags, b.description
+	FROM ROWS FROM (jsonb_to_recordset($1::jsonb) AS (title text, authors text[], isbn text,
+		year int, language text, tags text[], description text))
+		WITH ORDINALITY AS b(title, authors, isbn, year, language, tags, description, n)
+	ORDER BY b.n
+	RETURNING id, version, title, authors, COALESCE(isbn, ''), COALESCE(year, 0), language, tags, description`, string(data))
+	if err != nil {
+		log.Printf("[BULK] Ошибка при вставке пакета: %v", err)
+		return outcome{}, errors.New("failed to import books")
+	}
+	created := make([]Book, 0, len(books))
+	for rows.Next() {
+		var b Book
+		err := rows.Scan(&b.Id, &b.Version, &b.Title, pq.Array(&b.Authors), &b.ISBN, &b.Year,
+			&b.Language, pq.Array(&b.Tags), &b.Description)
+		if err != nil {
+			rows.Close()
+			log.Printf("[BULK] Ошибка при чтении вставленной строки: %v", err)
+			return outcome{}, errors.New("failed to import books")
+		}
+		created = append(created, b)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("[BULK] Ошибка при вставке пакета: %v", err)
+		return outcome{}, errors.New("failed to import books")
+	}
+
+	ids, events, err := recordBulk(tx, created, by, msgID)
+	if err != nil {
+		log.Printf("[BULK] Ошибка при записи аудита, ревизий и событий: %v", err)
+		return outcome{}, errors.New("failed to import books")
+	}
+	if err = tx.Commit(); err != nil {
+		log.Printf("[BULK] Ошибка при фиксации транзакции: %v", err)
+		return outcome{}, errors.New("failed to import books")
+	}
+	for _, ev := range events {
+		publishEvent(ev)
+	}
+
+	log.Printf("[BULK] Импортировано записей: %d (%s)", len(created), by)
+	return outcome{bookIDs: ids}, nil
+}
+
+// recordBulk пишет аудит, ревизии и события созданных книг тремя
+// запросами на весь пакет, а не по три на каждую книгу
+func recordBulk(tx *sql.Tx, books []Book, by principal.Principal, msgID string) ([]int, []BookEvent, error) {
+	ids := make([]int, len(books))
+	versions := make([]int, len(books))
+	docs := make([]string, len(books))
+	for i, book := range books {
+		data, err := json.Marshal(book)
+		if err != nil {
+			return nil, nil, err
+		}
+		ids[i], versions[i], docs[i] = book.Id, book.Version, string(data)
+	}
+	actor := sql.NullString{String: by.String(), Valid: by.Subject != ""}
+
+	_, err := tx.Exec(`
+	INSERT INTO audit_log (operation, book_id, actor, message_id, after)
+	SELECT 'create', b.id, $3, $4, b.book::jsonb
+	FROM unnest($1::int[], $2::text[]) WITH ORDINALITY AS b(id, book, n)
+	ORDER BY b.n`, pq.Array(ids), pq.Array(docs), actor,
+		sql.NullString{String: msgID, Valid: msgID != ""})
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO book_revisions (book_id, version, book, actor)
+	SELECT b.id, b.version, b.book::jsonb, $4
+	FROM unnest($1::int[], $2::int[], $3::text[]) AS b(id, version, book)
+	ON CONFLICT (book_id, version) DO NOTHING`, pq.Array(ids), pq.Array(versions), pq.Array(docs), actor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// События пишем последними: блокировка событий держится до фиксации
+	if err := lockEvents(tx); err != nil {
+		return nil, nil, err
+	}
+	rows, err := tx.Query(`
+	INSERT INTO book_events (type, book_id, version, book, actor)
+	SELECT $1, b.id, b.version, b.book::jsonb, $5
+	FROM unnest($2::int[], $3::int[], $4::text[]) WITH ORDINALITY AS b(id, version, book, n)
+	ORDER BY b.n
+	RETURNING id, book_id, created_at`, contracts.EventBookCreated,
+		pq.Array(ids), pq.Array(versions), pq.Array(docs), sql.NullString{String: by.String(), Valid: by.String() != ""})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	byBook := make(map[int]*Book, len(books))
+	for i := range books {
+		byBook[books[i].Id] = &books[i]
+	}
+	events := make([]BookEvent, 0, len(books))
+	for rows.Next() {
+		ev := BookEvent{Type: contracts.EventBookCreated, Actor: by.String()}
+		if err := rows.Scan(&ev.Id, &ev.BookId, &ev.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		ev.Book = byBook[ev.BookId]
+		ev.Version = ev.Book.Version
+		events = append(events, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// Рассылаем в порядке id, как их увидит дочитывающий подписчик
+	sort.Slice(events, func(i, j int) bool { return events[i].Id < events[j].Id })
+	return ids, events, nil
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// lockBook читает неудалённую книгу и блокирует строку до конца транзакции
+func lockBook(tx *sql.Tx, id int) (Book, error) {
+	b := Book{Id: id}
+	err := tx.QueryRow(`
+	SELECT title, authors, COALESCE(isbn, ''), COALESCE(year, 0), language, tags, description, version
+	FROM books WHERE id = $1 AND deleted_at IS NULL
+	FOR UPDATE`, id).Scan(&b.Title, pq.Array(&b.Authors), &b.ISBN, &b.Year,
+		&b.Language, pq.Array(&b.Tags), &b.Description, &b.Version)
+	return b, err
+}
+
+// recordAudit добавляет запись в audit_log в транзакции изменения.
+// before и after - состояние книги до и после команды, nil - его нет
+func recordAudit(tx *sql.Tx, operation string, bookID int, by principal.Principal, msgID string, before, after any) error {
+	values := make([]sql.NullString, 2)
+	for i, v := range []any{before, after} {
+		if v == nil {
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		values[i] = sql.NullString{String: string(data), Valid: true}
+	}
+	_, err := tx.Exec(`
+	INSERT INTO audit_log (operation, book_id, actor, message_id, before, after)
+	VALUES ($1, $2, $3, $4, $5, $6)`, operation,
+		sql.NullInt64{Int64: int64(bookID), Valid: bookID != 0},
+		sql.NullString{String: by.String(), Valid: by.Subject != ""},
+		sql.NullString{String: msgID, Valid: msgID != ""},
+		values[0], values[1])
+	return err
+}
+
+// recordRevision сохраняет поля книги на её текущей версии. Уже записанная
+// ревизия не перезаписывается
+func recordRevision(tx *sql.Tx, book Book, by principal.Principal) error {
+	data, err := json.Marshal(book)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO book_revisions (book_id, version, book, actor) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (book_id, version) DO NOTHING`, book.Id, book.Version, string(data),
+		sql.NullString{String: by.String(), Valid: by.Subject != ""})
+	return err
+}
+
+// eventsLockKey - ключ pg_advisory_xact_lock, под которым транзакции
+// по одной получают id события и фиксируются
+const eventsLockKey = 0x626f6f6b5f6576
+
+// recordEvent сохраняет событие в book_events в той же транзакции, что и
+// само изменение, чтобы подписчики могли дочитать пропущенное. Блокировка
+// держится до фиксации, поэтому события видны строго в порядке id: иначе
+// подписчик с Last-Event-ID 11 навсегда пропустил бы позже зафиксированное 10
+func recordEvent(tx *sql.Tx, ev *BookEvent) error {
+	if err := lockEvents(tx); err != nil {
+		return err
+	}
+	var book sql.NullString
+	actor := sql.NullString{String: ev.Actor, Valid: ev.Actor != ""}
+	if ev.Book != nil {
+		data, err := json.Marshal(ev.Book)
+		if err != nil {
+			return err
+		}
+		book = sql.NullString{String: string(data), Valid: true}
+	}
+	return tx.QueryRow(`
+	INSERT INTO book_events (type, book_id, version, book, actor) VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`, ev.Type, ev.BookId, ev.Version, book, actor).Scan(&ev.Id, &ev.CreatedAt)
+}
+
+func lockEvents(tx *sql.Tx) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, eventsLockKey)
+	return err
+}
+
+// publishEvent рассылает событие после фиксации транзакции. Если публикация
+// не удалась, событие всё равно лежит в book_events и придёт при
+// переподключении подписчика
+func publishEvent(ev BookEvent) {
+	body, err := contracts.Encode(ev)
+	if err != nil {
+		log.Printf("[EVENT] Ошибка сериализации события %d: %v", ev.Id, err)
+		return
+	}
+	ch, err := events.Get()
+	if err != nil {
+		log.Printf("[EVENT] Событие %d не опубликовано: %v", ev.Id, err)
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = ch.PublishWithContext(ctx, contracts.EventsExchange, ev.Type, false, false, amqp091.Publishing{
+		ContentType: "application/json",
+		MessageId:   strconv.FormatInt(ev.Id, 10),
+		Body:        body,
+	})
+	if err != nil {
+		log.Printf("[EVENT] Ошибка публикации события %d: %v", ev.Id, err)
+	}
+}
 
-	if count == 0 {
-		log.Printf("[DELETE] Запись с ID %d не найдена", book.ID)
-	} else {
-		log.Printf("[DELETE] Успешно удалена запись с ID %d", book.ID)
+// tombstoneCache помечает книгу в кэше удалённой: GetOne не перезаписывает
+// такую запись и отвечает 404. Запись живёт дольше любого запроса GetOne,
+// который мог прочитать книгу до удаления
+func tombstoneCache(id int) {
+	if err := rdb.Set(context.Background(), contracts.CacheKey(id), contracts.CacheTombstone, time.Hour).Err(); err != nil {
+		log.Printf("[CACHE] Ошибка при пометке удаления для ID %d: %v", id, err)
+	}
+}
+
+// invalidateCache помечает книгу в кэше устаревшей до версии version:
+// GetOne заменит метку только книгой той же или более новой версии.
+// Простой Del не годится: GetOne, прочитавший строку до фиксации, записал
+// бы старую версию обратно
+func invalidateCache(id, version int) {
+	if err := rdb.Set(context.Background(), contracts.CacheKey(id), contracts.StaleMarker(version), time.Hour).Err(); err != nil {
+		log.Printf("[CACHE] Ошибка при сбросе кэша для ID %d: %v", id, err)
 	}
 }
 